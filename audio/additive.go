@@ -0,0 +1,106 @@
+/*
+Copyright 2026 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package audio
+
+import (
+	"math"
+
+	"github.com/nf/sigourney/fast"
+)
+
+// additivePartials is the number of partials summed by an Additive.
+const additivePartials = 32
+
+// NewAdditive returns an additive oscillator that sums sine partials above
+// the fundamental set by its "pitch" input. Partial k, counting the
+// fundamental as 1, has amplitude 1/k^spread and frequency k^(1+stretch)
+// times the fundamental.
+//
+// With its "stretch" input at 0, the default, the partials are exact
+// harmonics; raising it spreads the upper partials apart, away from the
+// harmonic series, for bell and metallic tones, and lowering it squeezes
+// them together. Its "spread" input, 1 by default for the bright rolloff of
+// a sawtooth, sets how fast the partials fade: higher is duller, and 0
+// sounds every partial equally. Partials at or above the Nyquist frequency
+// are dropped, so that the oscillator doesn't alias.
+func NewAdditive() *Additive {
+	o := &Additive{lastPitch: Sample(math.NaN())}
+	o.inputs("pitch", &o.pitch, "stretch", &o.stretch, "spread", &o.spread)
+	o.setDefault("spread", 1)
+	return o
+}
+
+type Additive struct {
+	sink
+	pitch           Processor // 0.1/oct, 0 == 440Hz
+	stretch, spread source
+
+	pos [additivePartials]float64 // phase of each partial, in cycles
+
+	// The partials for the last parameters seen.
+	lastPitch, lastStretch, lastSpread Sample
+	inc, amp                           [additivePartials]float64
+	n                                  int // number of partials below Nyquist
+}
+
+func (o *Additive) Process(s []Sample) {
+	o.pitch.Process(s)
+	stretch, spread := o.stretch.Process(), o.spread.Process()
+	for i := range s {
+		if s[i] != o.lastPitch || stretch[i] != o.lastStretch || spread[i] != o.lastSpread {
+			o.partials(s[i], stretch[i], spread[i])
+		}
+		var v float64
+		for k := 0; k < o.n; k++ {
+			v += o.amp[k] * fast.Sin(o.pos[k]*2*math.Pi)
+			if o.pos[k] += o.inc[k]; o.pos[k] >= 1 {
+				o.pos[k]--
+			}
+		}
+		s[i] = Sample(v)
+	}
+}
+
+// partials sets the frequencies and amplitudes of the partials, normalized
+// so that the amplitudes sum to 1.
+func (o *Additive) partials(pitch, stretch, spread Sample) {
+	o.lastPitch, o.lastStretch, o.lastSpread = pitch, stretch, spread
+	hz := SampleToHz(pitch)
+	var sum float64
+	o.n = 0
+	for k := 0; k < additivePartials; k++ {
+		h := float64(k + 1)
+		f := hz * math.Pow(h, 1+float64(stretch))
+		if f >= waveHz/2 {
+			break
+		}
+		o.inc[k] = f / waveHz
+		o.amp[k] = math.Pow(h, -float64(spread))
+		sum += o.amp[k]
+		o.n++
+	}
+	for k := 0; k < o.n; k++ {
+		o.amp[k] /= sum
+	}
+}
+
+// Reset returns the partials to the start of their cycles.
+func (o *Additive) Reset() {
+	for k := range o.pos {
+		o.pos[k] = 0
+	}
+}
@@ -16,7 +16,28 @@ limitations under the License.
 
 package audio
 
-import "testing"
+import (
+	"bytes"
+	"encoding/binary"
+	"flag"
+	"io/ioutil"
+	"math"
+	"math/cmplx"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"code.google.com/p/portaudio-go/portaudio"
+	"github.com/nf/sigourney/dsp"
+	"github.com/rakyll/portmidi"
+)
 
 func BenchmarkSin(b *testing.B) {
 	b.StopTimer()
@@ -40,3 +61,3607 @@ func BenchmarkFMSin(b *testing.B) {
 		o.Process(buf)
 	}
 }
+
+// benchBlocks is the number of blocks rendered by each iteration of the
+// module benchmarks.
+const benchBlocks = 100
+
+// benchmark measures the cost of rendering benchBlocks blocks from p,
+// after rendering a block to warm up its inputs.
+func benchmark(b *testing.B, p Processor) {
+	BenchProcess(p, 1)
+	b.ResetTimer()
+	BenchProcess(p, b.N*benchBlocks)
+}
+
+// modulation returns a slowly varying signal, for driving the inputs of
+// benchmarked modules so that they don't see constant input.
+func modulation() Processor {
+	o := NewLFO()
+	o.Input("rate", Value(5))
+	m := NewMul()
+	m.Input("a", o)
+	m.Input("b", Value(0.1))
+	return m
+}
+
+func BenchmarkSquare(b *testing.B) {
+	o := NewSquare()
+	o.Input("pitch", modulation())
+	benchmark(b, o)
+}
+
+func BenchmarkSquareOversample(b *testing.B) {
+	o := NewSquare()
+	o.Input("pitch", modulation())
+	o.SetOversample(4)
+	benchmark(b, o)
+}
+
+func BenchmarkModSin(b *testing.B) {
+	o := NewSin()
+	o.Input("pitch", modulation())
+	benchmark(b, o)
+}
+
+func BenchmarkMul(b *testing.B) {
+	m := NewMul()
+	m.Input("a", modulation())
+	m.Input("b", modulation())
+	benchmark(b, m)
+}
+
+func BenchmarkSum(b *testing.B) {
+	s := NewSum()
+	s.Input("a", modulation())
+	s.Input("b", modulation())
+	benchmark(b, s)
+}
+
+func sumChain(n int) Processor {
+	var p Processor = Value(0.1)
+	for i := 1; i < n; i++ {
+		s := NewSum()
+		s.Input("a", p)
+		s.Input("b", Value(0.1*Sample(i+1)))
+		p = s
+	}
+	return p
+}
+
+func sumN(n int) Processor {
+	s := NewSumN(n)
+	for i := 0; i < n; i++ {
+		s.Input("in"+strconv.Itoa(i), Value(0.1*Sample(i+1)))
+	}
+	return s
+}
+
+func BenchmarkSumChain(b *testing.B) {
+	benchmark(b, sumChain(8))
+}
+
+func BenchmarkSumN(b *testing.B) {
+	benchmark(b, sumN(8))
+}
+
+func BenchmarkEnv(b *testing.B) {
+	e := NewEnv()
+	e.Input("trig", &pulses{n: waveHz / 4})
+	e.Input("att", Value(0.001))
+	e.Input("dec", Value(0.01))
+	benchmark(b, e)
+}
+
+func BenchmarkClip(b *testing.B) {
+	c := NewClip()
+	c.Input("in", modulation())
+	benchmark(b, c)
+}
+
+func BenchmarkSoftClip(b *testing.B) {
+	c := NewSoftClip()
+	c.Input("in", modulation())
+	benchmark(b, c)
+}
+
+func BenchmarkRand(b *testing.B) {
+	r := NewRand()
+	r.Input("trig", &pulses{n: 100})
+	r.Input("max", Value(1))
+	benchmark(b, r)
+}
+
+func BenchmarkWalk(b *testing.B) {
+	w := NewWalk()
+	w.Input("trig", &pulses{n: 100})
+	w.Input("step", Value(0.1))
+	w.Input("lo", Value(-1))
+	w.Input("hi", Value(1))
+	benchmark(b, w)
+}
+
+func BenchmarkLFO(b *testing.B) {
+	o := NewLFO()
+	o.Input("rate", Value(5))
+	benchmark(b, o)
+}
+
+func BenchmarkTremolo(b *testing.B) {
+	t := NewTremolo()
+	t.Input("in", modulation())
+	t.Input("rate", Value(5))
+	t.Input("depth", Value(0.5))
+	benchmark(b, t)
+}
+
+func BenchmarkVibrato(b *testing.B) {
+	v := NewVibrato()
+	v.Input("in", modulation())
+	v.Input("rate", Value(5))
+	v.Input("depth", Value(0.5))
+	benchmark(b, v)
+}
+
+func BenchmarkAbs(b *testing.B) {
+	a := NewAbs()
+	a.Input("in", modulation())
+	benchmark(b, a)
+}
+
+func BenchmarkRectify(b *testing.B) {
+	r := NewRectify(RectifyPositive)
+	r.Input("in", modulation())
+	benchmark(b, r)
+}
+
+func BenchmarkInvert(b *testing.B) {
+	v := NewInvert()
+	v.Input("in", modulation())
+	benchmark(b, v)
+}
+
+func BenchmarkChord(b *testing.B) {
+	c := NewChord()
+	c.Input("root", modulation())
+	s := NewSum()
+	s.Input("a", c.Note(1))
+	s.Input("b", c.Note(2))
+	benchmark(b, s)
+}
+
+func BenchmarkDup(b *testing.B) {
+	d := NewDup(modulation())
+	s := NewSum()
+	s.Input("a", d.Output())
+	s.Input("b", d.Output())
+	benchmark(b, s)
+}
+
+// BenchmarkDupFanout feeds a Dup to the modulation inputs of many modules.
+func BenchmarkDupFanout(b *testing.B) {
+	d := NewDup(modulation())
+	var p Processor = Value(0)
+	for i := 0; i < 8; i++ {
+		m := NewMul()
+		m.Input("a", Value(1))
+		m.Input("b", d.Output())
+		s := NewSum()
+		s.Input("a", p)
+		s.Input("b", m)
+		p = s
+	}
+	benchmark(b, p)
+}
+
+// pulses emits a single-sample trigger every n samples, starting with the
+// first sample.
+type pulses struct {
+	n, i int
+}
+
+func (p *pulses) Process(s []Sample) {
+	for i := range s {
+		if p.i%p.n == 0 {
+			s[i] = 1
+		} else {
+			s[i] = 0
+		}
+		p.i++
+	}
+}
+
+// tape plays back s, followed by silence.
+type tape struct {
+	s []Sample
+	i int
+}
+
+func (t *tape) Process(s []Sample) {
+	for i := range s {
+		s[i] = 0
+		if t.i < len(t.s) {
+			s[i] = t.s[t.i]
+		}
+		t.i++
+	}
+}
+
+// render processes p for the given number of blocks, ticking t after
+// each one, and returns the concatenated output.
+func render(p Processor, blocks int, t ...Ticker) []Sample {
+	var out []Sample
+	buf := make([]Sample, nSamples)
+	for i := 0; i < blocks; i++ {
+		p.Process(buf)
+		for _, t := range t {
+			t.Tick()
+		}
+		out = append(out, buf...)
+	}
+	return out
+}
+
+// triggers returns the sample positions of the single-sample triggers in s.
+func triggers(s []Sample) []int {
+	var pos []int
+	last := false
+	for i, v := range s {
+		high := v > TriggerThreshold
+		if high && !last {
+			pos = append(pos, i)
+		}
+		last = high
+	}
+	return pos
+}
+
+func TestSeqProb(t *testing.T) {
+	for _, c := range []struct {
+		prob float64
+		want int
+	}{
+		{1, 16},
+		{0, 0},
+	} {
+		q := NewSeq([]Step{{Prob: c.prob}, {Pitch: 0.1, Prob: c.prob}})
+		q.Seed(1)
+		q.Input("clock", &pulses{n: 64})
+		got := triggers(render(q, 4, q))
+		if len(got) != c.want {
+			t.Errorf("prob %v: got %d triggers, want %d", c.prob, len(got), c.want)
+		}
+	}
+}
+
+func TestSeqRatchet(t *testing.T) {
+	q := NewSeq([]Step{{Prob: 1, Ratchet: 4}})
+	q.Input("clock", &pulses{n: 64})
+	got := triggers(render(q, 1, q))
+	// The first step has no measured clock period, so it can't ratchet.
+	want := []int{0, 64, 80, 96, 112, 128, 144, 160, 176, 192, 208, 224, 240}
+	if !equalInts(got, want) {
+		t.Errorf("triggers at %v, want %v", got, want)
+	}
+}
+
+// highs returns the start and end of each run of high samples in s.
+func highs(s []Sample) [][2]int {
+	var runs [][2]int
+	for i, v := range s {
+		if v <= 0 {
+			continue
+		}
+		if n := len(runs); n > 0 && runs[n-1][1] == i {
+			runs[n-1][1]++
+		} else {
+			runs = append(runs, [2]int{i, i + 1})
+		}
+	}
+	return runs
+}
+
+func TestSeqTie(t *testing.T) {
+	q := NewSeq([]Step{{Prob: 1}, {Pitch: 0.1, Prob: 1, Tie: true}, {Prob: 1}, {Prob: 1}})
+	q.Input("clock", &pulses{n: 64})
+	gate, pitch := q.Gate(), q.Pitch()
+	g, p := make([]Sample, nSamples), make([]Sample, nSamples)
+	trig := render(q, 1)
+	gate.Process(g)
+	pitch.Process(p)
+	// The first two steps are one note, whose gate is held until half
+	// way through the second; the others have gates of half a step.
+	want := [][2]int{{0, 96}, {128, 160}, {192, 224}}
+	if got := highs(g); !reflect.DeepEqual(got, want) {
+		t.Errorf("gates %v, want %v", got, want)
+	}
+	if got, want := triggers(trig), []int{0, 128, 192}; !equalInts(got, want) {
+		t.Errorf("triggers at %v, want %v", got, want)
+	}
+	if p[63] != 0 || p[64] != 0.1 || p[128] != 0 {
+		t.Errorf("pitch around the tie = %v, %v, %v, want 0, 0.1, 0", p[63], p[64], p[128])
+	}
+
+	// Untied steps make distinct pulses even with a gate length of 1,
+	// and before the tempo is known.
+	q = NewSeq([]Step{{Prob: 1}})
+	q.Input("clock", &pulses{n: 64})
+	q.Input("gatelen", Value(1))
+	render(q, 1)
+	q.Gate().Process(g)
+	for _, r := range highs(g)[1:] {
+		if r[1]-r[0] > 63 {
+			t.Errorf("gate %v is longer than a step", r)
+		}
+	}
+	if n := len(highs(g)); n != 4 {
+		t.Errorf("%d gates, want 4", n)
+	}
+}
+
+func equalInts(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func equalSamples(a, b []Sample) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestClockSwing(t *testing.T) {
+	c := NewClock()
+	c.Input("bpm", Value(waveHz*60/100)) // 100 samples per beat
+	c.Input("swing", Value(0.5))
+	got := triggers(render(c, 2))
+	want := []int{0, 134, 200, 334, 400}
+	if !equalInts(got, want) {
+		t.Errorf("triggers at %v, want %v", got, want)
+	}
+}
+
+func TestSplit(t *testing.T) {
+	st := NewStereo()
+	st.Input("left", Value(1))
+	st.Input("right", Value(0.5))
+	s := NewSplit(st)
+	ts := Tickers(s)
+	for _, c := range []struct {
+		name string
+		p    Processor
+		want Sample
+	}{
+		{"left", s.Left(), 1},
+		{"right", s.Right(), 0.5},
+		{"mono", s, 0.75},
+	} {
+		if v := render(c.p, 1, ts...)[0]; v != c.want {
+			t.Errorf("%s output %v, want %v", c.name, v, c.want)
+		}
+	}
+}
+
+func TestWidth(t *testing.T) {
+	in := NewStereo()
+	in.Input("left", Value(0.8))
+	in.Input("right", Value(-0.2))
+	w := NewWidth()
+	w.Input("in", in)
+	l, r := make([]Sample, nSamples), make([]Sample, nSamples)
+	for _, c := range []struct {
+		width, l, r Sample
+	}{
+		{0, 0.3, 0.3},
+		{1, 0.8, -0.2},
+		{2, 1.3, -0.7},
+	} {
+		w.Input("width", Value(c.width))
+		w.ProcessStereo(l, r)
+		for i := range l {
+			if !near(l[i], c.l) || !near(r[i], c.r) {
+				t.Errorf("width %v: got %v, %v, want %v, %v", c.width, l[i], r[i], c.l, c.r)
+				break
+			}
+		}
+	}
+}
+
+func near(a, b Sample) bool {
+	const epsilon = 1e-9
+	return a-b < epsilon && b-a < epsilon
+}
+
+func TestTremolo(t *testing.T) {
+	tr := NewTremolo()
+	tr.Input("in", Value(1))
+	tr.Input("rate", Value(waveHz/100)) // 100 samples per cycle
+	tr.Input("depth", Value(1))
+	s := render(tr, 1)
+	for _, c := range []struct {
+		i    int
+		want Sample
+	}{
+		{0, 0.5}, {25, 1}, {50, 0.5}, {75, 0}, {125, 1}, {175, 0},
+	} {
+		if d := s[c.i] - c.want; d > 0.001 || d < -0.001 {
+			t.Errorf("sample %d = %v, want %v", c.i, s[c.i], c.want)
+		}
+	}
+
+	tr.Input("depth", Value(0))
+	for i, v := range render(tr, 1) {
+		if v != 1 {
+			t.Fatalf("depth 0: sample %d = %v, want 1", i, v)
+		}
+	}
+}
+
+func TestVibrato(t *testing.T) {
+	v := NewVibrato()
+	v.Input("rate", Value(waveHz/100)) // peaks at sample 25
+	v.Input("depth", Value(1))
+	s := render(v, 1)
+	got := SampleToHz(s[25]) / SampleToHz(0)
+	if want := math.Exp2(1.0 / 12); math.Abs(got-want) > 0.0001 {
+		t.Errorf("peak frequency ratio = %v, want %v", got, want)
+	}
+
+	v.Input("delay", Value(1))
+	v.Input("trig", &pulses{n: waveHz})
+	s = render(v, 1)
+	if s[25] >= 0.1*semitone {
+		t.Errorf("delayed vibrato at sample 25 = %v, want less than %v", s[25], 0.1*semitone)
+	}
+}
+
+func TestCounter(t *testing.T) {
+	for _, max := range []Value{4, 3.9999} { // as from a knob
+		c := NewCounter()
+		c.Input("trig", &pulses{n: 10})
+		c.Input("max", max)
+		s := render(c, 1)
+		for i, want := range []Sample{1, 2, 3, 0, 1, 2, 3, 0} {
+			if got := s[i*10]; got != want {
+				t.Errorf("max %v: after %d triggers count = %v, want %v", max, i+1, got, want)
+			}
+		}
+	}
+}
+
+func TestBurst(t *testing.T) {
+	for _, count := range []Value{4, 3.9999} { // as from a knob
+		b := NewBurst()
+		b.Input("trig", &pulses{n: 1000})
+		b.Input("count", count)
+		b.Input("rate", Value(waveHz/20))
+		got := triggers(render(b, 2, b))
+		want := []int{0, 20, 40, 60}
+		if !equalInts(got, want) {
+			t.Errorf("count %v: triggers at %v, want %v", count, got, want)
+		}
+	}
+}
+
+func TestWalk(t *testing.T) {
+	const step, lo, hi = 0.1, -0.25, 0.25
+	w := NewWalk()
+	w.Seed(1)
+	w.Input("trig", &pulses{n: 2})
+	w.Input("step", Value(step))
+	w.Input("lo", Value(lo))
+	w.Input("hi", Value(hi))
+	s := render(w, 4)
+	last := Sample(0)
+	for i, v := range s {
+		if d := v - last; d > step || d < -step {
+			t.Fatalf("sample %d: moved by %v, more than step %v", i, d, step)
+		}
+		if v < lo || v > hi {
+			t.Fatalf("sample %d: %v outside range [%v, %v]", i, v, lo, hi)
+		}
+		last = v
+	}
+}
+
+func TestLatch(t *testing.T) {
+	l := NewLatch()
+	l.Input("set", &pulses{n: 100})         // 0, 100, 200
+	l.Input("reset", &pulses{n: 50, i: 40}) // 10, 60, 110, ...
+	s := render(l, 1)
+	for _, c := range []struct {
+		i    int
+		want Sample
+	}{
+		{0, 1}, {9, 1}, {10, 0}, {99, 0}, {100, 1}, {110, 0},
+	} {
+		if s[c.i] != c.want {
+			t.Errorf("set/reset: sample %d = %v, want %v", c.i, s[c.i], c.want)
+		}
+	}
+
+	l = NewLatch()
+	l.Input("set", &pulses{n: 100})
+	l.Input("reset", &pulses{n: 100})
+	if s := render(l, 1); s[0] != 0 {
+		t.Errorf("simultaneous set and reset = %v, want 0", s[0])
+	}
+
+	l = NewLatch()
+	l.Input("trig", &pulses{n: 10})
+	s = render(l, 1)
+	for i, want := range []Sample{1, 0, 1, 0} {
+		if got := s[i*10]; got != want {
+			t.Errorf("toggle %d = %v, want %v", i+1, got, want)
+		}
+	}
+}
+
+func TestRectifiers(t *testing.T) {
+	for _, c := range []struct {
+		in, abs, pos, neg Sample
+	}{
+		{0.5, 0.5, 0.5, 0},
+		{-0.5, 0.5, 0, -0.5},
+		{0, 0, 0, 0},
+		{-1, 1, 0, -1},
+	} {
+		abs, pos, neg := NewAbs(), NewRectify(RectifyPositive), NewRectify(RectifyNegative)
+		for _, r := range []struct {
+			name string
+			p    Processor
+			want Sample
+		}{
+			{"abs", abs, c.abs},
+			{"positive", pos, c.pos},
+			{"negative", neg, c.neg},
+		} {
+			r.p.(Sink).Input("in", Value(c.in))
+			if got := render(r.p, 1)[0]; got != r.want {
+				t.Errorf("%s(%v) = %v, want %v", r.name, c.in, got, r.want)
+			}
+		}
+	}
+}
+
+func TestInvert(t *testing.T) {
+	v := NewInvert()
+	v.Input("in", Value(0.5))
+	if got := render(v, 1)[0]; got != -0.5 {
+		t.Errorf("got %v, want -0.5", got)
+	}
+	v.Input("when", &pulses{n: 2})
+	s := render(v, 1)
+	if s[0] != -0.5 || s[1] != 0.5 {
+		t.Errorf("gated: got %v, %v, want -0.5, 0.5", s[0], s[1])
+	}
+}
+
+func TestSoftClip(t *testing.T) {
+	c := NewSoftClip()
+	last := Sample(-1)
+	for _, in := range []Sample{-100, -2, -1, -0.5, 0, 0.5, 1, 2, 100} {
+		c.Input("in", Value(in))
+		got := render(c, 1)[0]
+		if got < -1 || got > 1 {
+			t.Errorf("SoftClip(%v) = %v, outside [-1, 1]", in, got)
+		}
+		if got < last {
+			t.Errorf("SoftClip(%v) = %v, less than for a smaller input", in, got)
+		}
+		last = got
+	}
+	c.Input("in", Value(1))
+	if got := render(c, 1)[0]; got > 0.8 {
+		t.Errorf("SoftClip(1) = %v, want a rounded knee below 0.8", got)
+	}
+}
+
+func TestVCA(t *testing.T) {
+	gains := func(mode VCAMode) (db []float64) {
+		v := NewVCA(mode)
+		v.Input("in", Value(1))
+		v.Input("offset", Value(0.25))
+		for _, cv := range []Sample{0, 0.25, 0.5, 0.75} {
+			v.Input("cv", Value(cv))
+			g := render(v, 1)[0]
+			db = append(db, 20*math.Log10(float64(g)))
+		}
+		return db
+	}
+	// An even sweep of the control signal should give even steps in dB.
+	exp := gains(VCAExp)
+	for i := 1; i < len(exp); i++ {
+		if d := exp[i] - exp[i-1]; math.Abs(d-vcaRange/4) > 0.01 {
+			t.Errorf("exponential step %d is %.2fdB, want %vdB", i, d, vcaRange/4)
+		}
+	}
+	if math.Abs(exp[3]) > 0.01 {
+		t.Errorf("exponential full scale is %.2fdB, want 0dB", exp[3])
+	}
+	lin := gains(VCALinear)
+	if first, last := lin[1]-lin[0], lin[3]-lin[2]; first < 2*last {
+		t.Errorf("linear steps %.2fdB and %.2fdB, expected uneven steps", first, last)
+	}
+
+	// Two VCAPower gains with complementary controls sum to unit power.
+	a, b := NewVCA(VCAPower), NewVCA(VCAPower)
+	a.Input("in", Value(1))
+	b.Input("in", Value(1))
+	a.Input("cv", Value(0.3))
+	b.Input("cv", Value(0.7))
+	ga, gb := render(a, 1)[0], render(b, 1)[0]
+	if p := ga*ga + gb*gb; p < 0.999 || p > 1.001 {
+		t.Errorf("constant-power gains %v and %v have power %v, want 1", ga, gb, p)
+	}
+}
+
+func TestChord(t *testing.T) {
+	const c4 = -9 * semitone
+	c := NewChord()
+	c.Input("root", Value(c4))
+	c.Input("type", Value(ChordMajor))
+	for i, semis := range []float64{0, 4, 7} {
+		s := render(c.Note(i), 1, c)
+		got := SampleToHz(s[0])
+		want := 440 * math.Exp2((-9+semis)/12)
+		if math.Abs(got-want) > 0.01 {
+			t.Errorf("note %d = %.2fHz, want %.2fHz", i, got, want)
+		}
+	}
+
+	// A type just short of ChordMinor, as from a knob, selects it.
+	c.Input("type", Value(ChordMinor-0.0001))
+	got := SampleToHz(render(c.Note(1), 1, c)[0])
+	if want := 440 * math.Exp2((-9+3)/12.0); math.Abs(got-want) > 0.01 {
+		t.Errorf("minor third = %.2fHz, want %.2fHz", got, want)
+	}
+
+	for _, i := range []int{-1, chordSize} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("Note(%d) did not panic", i)
+				}
+			}()
+			c.Note(i)
+		}()
+	}
+}
+
+func TestSong(t *testing.T) {
+	const a, b = 0.1, 0.2
+	g := NewSong([]Part{
+		{NewSeq([]Step{{Pitch: a, Prob: 1}, {Pitch: a, Prob: 1}}), 2},
+		{NewSeq([]Step{{Pitch: b, Prob: 1}}), 1},
+	})
+	g.Input("clock", &pulses{n: 10})
+	s := render(g.Pitch(), 1, g)
+	for i, want := range []Sample{a, a, a, a, b, a, a, a, a, b} {
+		if got := s[i*10]; got != want {
+			t.Errorf("step %d pitch = %v, want %v", i, got, want)
+		}
+	}
+}
+
+func TestEOC(t *testing.T) {
+	e := NewEnv()
+	e.Input("trig", &pulses{n: 1000})
+	e.Input("att", Value(0.0001))
+	e.Input("dec", Value(0.0002))
+	var out, eoc []Sample
+	for i := 0; i < 2; i++ {
+		out = append(out, render(e, 1)...)
+		eoc = append(eoc, render(e.EOC(), 1)...)
+	}
+	end := 0
+	for i := 1; i < len(out); i++ {
+		if out[i] == 0 && out[i-1] > 0 {
+			end = i
+			break
+		}
+	}
+	if got := triggers(eoc); end == 0 || !equalInts(got, []int{end}) {
+		t.Errorf("env: EOC at %v, want [%d]", got, end)
+	}
+
+	q := NewSeq([]Step{{Prob: 1}, {Prob: 1}, {Prob: 1}})
+	q.Input("clock", &pulses{n: 10})
+	if got, want := triggers(render(q.EOC(), 1, q))[:3], []int{20, 50, 80}; !equalInts(got, want) {
+		t.Errorf("seq: EOC at %v, want %v", got, want)
+	}
+
+	b := NewBurst()
+	b.Input("trig", &pulses{n: 1000})
+	b.Input("count", Value(3))
+	b.Input("rate", Value(waveHz/20))
+	if got, want := triggers(render(b.EOC(), 1, b)), []int{40}; !equalInts(got, want) {
+		t.Errorf("burst: EOC at %v, want %v", got, want)
+	}
+}
+
+func TestWalkGraph(t *testing.T) {
+	s := NewSin()
+	d := NewDup(s)
+	m := NewMul()
+	m.Input("a", d.Output())
+	m.Input("b", d.Output())
+
+	var n, sins int
+	WalkGraph(m, func(p Processor) {
+		n++
+		if _, ok := p.(*Sin); ok {
+			sins++
+		}
+	})
+	// The Mul, the Sin, and the Value(0) of the Sin's inputs.
+	if n != 3 || sins != 1 {
+		t.Errorf("visited %d nodes and %d Sins, want 3 and 1", n, sins)
+	}
+
+	// A cycle is followed only once.
+	sum := NewSum()
+	sum.Input("b", sum)
+	n = 0
+	WalkGraph(sum, func(Processor) { n++ })
+	if n != 2 {
+		t.Errorf("visited %d nodes in a cycle, want 2", n)
+	}
+
+	// Processors of types that can't be compared don't make it panic.
+	// A slice is visited once, and a func each time it is reached.
+	sl, fn := sliceProc{1, 2}, funcProc(func([]Sample) {})
+	a, b := NewSum(), NewSum()
+	a.Input("a", sl)
+	a.Input("b", fn)
+	b.Input("a", sl)
+	b.Input("b", fn)
+	m = NewMul()
+	m.Input("a", a)
+	m.Input("b", b)
+	var sls, fns int
+	WalkGraph(m, func(p Processor) {
+		switch p.(type) {
+		case sliceProc:
+			sls++
+		case funcProc:
+			fns++
+		}
+	})
+	if sls != 1 || fns != 2 {
+		t.Errorf("visited slice %d times and func %d times, want 1 and 2", sls, fns)
+	}
+	if err := CheckLoops(m); err != nil {
+		t.Error(err)
+	}
+	ExportDOT(m)
+}
+
+// sliceProc and funcProc are Processors whose types can't be compared.
+type sliceProc []Sample
+
+func (p sliceProc) Process(s []Sample) { copy(s, p) }
+
+type funcProc func([]Sample)
+
+func (f funcProc) Process(s []Sample) { f(s) }
+
+func TestTickers(t *testing.T) {
+	c := NewChord()
+	d := NewDup(c.Note(1))
+	s := NewSum()
+	s.Input("a", d.Output())
+	s.Input("b", d.Output())
+	ts := Tickers(s)
+	if len(ts) != 2 || ts[0] != d || ts[1] != c {
+		t.Errorf("Tickers = %v, want the Dup and the Chord", ts)
+	}
+}
+
+var update = flag.Bool("update", false, "update golden files in testdata")
+
+// goldenTolerance is the largest difference from a golden file's samples
+// that a rendering may have.
+const goldenTolerance = 1e-6
+
+// checkGolden compares s to the samples stored as little-endian float32s
+// in testdata/name.golden, or rewrites the file if the -update flag is set.
+func checkGolden(t *testing.T, name string, s []Sample) {
+	path := filepath.Join("testdata", name+".golden")
+	f32 := make([]float32, len(s))
+	for i, v := range s {
+		f32[i] = float32(v)
+	}
+	if *update {
+		var buf bytes.Buffer
+		binary.Write(&buf, binary.LittleEndian, f32)
+		if err := ioutil.WriteFile(path, buf.Bytes(), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := make([]float32, len(b)/4)
+	if err := binary.Read(bytes.NewReader(b), binary.LittleEndian, want); err != nil {
+		t.Fatal(err)
+	}
+	if len(want) != len(f32) {
+		t.Fatalf("%s: rendered %d samples, golden file has %d", name, len(f32), len(want))
+	}
+	for i := range want {
+		if d := math.Abs(float64(f32[i] - want[i])); d > goldenTolerance {
+			t.Fatalf("%s: sample %d = %v, want %v", name, i, f32[i], want[i])
+		}
+	}
+}
+
+func TestGoldenSin(t *testing.T) {
+	o := NewSin()
+	o.Input("pitch", Value(0.1))
+	checkGolden(t, "sin", render(o, 4))
+}
+
+func TestGoldenSquare(t *testing.T) {
+	o := NewSquare()
+	o.Input("pitch", Value(-0.15))
+	checkGolden(t, "square", render(o, 4))
+}
+
+func TestGoldenEnv(t *testing.T) {
+	e := NewEnv()
+	e.Input("trig", &pulses{n: 2048})
+	e.Input("att", Value(0.001))
+	e.Input("dec", Value(0.002))
+	checkGolden(t, "env", render(e, 16))
+}
+
+func TestGoldenFM(t *testing.T) {
+	mod := NewSin()
+	mod.Input("pitch", Value(-0.3))
+	m := NewMul()
+	m.Input("a", mod)
+	m.Input("b", Value(0.05))
+	o := NewSin()
+	o.Input("pitch", m)
+	checkGolden(t, "fm", render(o, 4))
+}
+
+func TestResample(t *testing.T) {
+	const period = 100
+	in := make([]Sample, 4096)
+	for i := range in {
+		in[i] = Sample(math.Sin(2 * math.Pi * float64(i) / period))
+	}
+	for _, ratio := range []float64{2, 0.5, 44100.0 / 48000} {
+		out := Resample(in, ratio)
+		if want := int(float64(len(in)) * ratio); len(out) != want {
+			t.Errorf("ratio %v: got %d samples, want %d", ratio, len(out), want)
+		}
+		// Away from the edges the output should be the same sine,
+		// with its period scaled by the ratio.
+		for i := len(out) / 4; i < len(out)*3/4; i++ {
+			want := math.Sin(2 * math.Pi * float64(i) / (period * ratio))
+			if d := math.Abs(float64(out[i]) - want); d > 0.001 {
+				t.Errorf("ratio %v: sample %d = %v, want %v", ratio, i, out[i], want)
+				break
+			}
+		}
+	}
+}
+
+func TestResampleBadRatio(t *testing.T) {
+	for _, ratio := range []float64{0, -1, math.NaN(), math.Inf(1)} {
+		for name, f := range map[string]func(){
+			"Resample":    func() { Resample(make([]Sample, 10), ratio) },
+			"NewResample": func() { NewResample(ratio) },
+		} {
+			func() {
+				defer func() {
+					if recover() == nil {
+						t.Errorf("%s(%v) did not panic", name, ratio)
+					}
+				}()
+				f()
+			}()
+		}
+	}
+}
+
+func TestResampleStream(t *testing.T) {
+	const ratio = 1.5
+	src := NewLFO()
+	src.Input("rate", Value(waveHz/100))
+	in := render(src, 16)
+
+	src = NewLFO()
+	src.Input("rate", Value(waveHz/100))
+	r := NewResample(ratio)
+	r.Input("in", src)
+	got := render(r, 16)
+	want := Resample(in, ratio)
+	for i := range got {
+		if d := got[i] - want[i]; d > 1e-9 || d < -1e-9 {
+			t.Fatalf("sample %d = %v, want %v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestNoteRoundTrip(t *testing.T) {
+	for n := 0; n < 128; n++ {
+		if got := AsInt(PitchToNote(NoteToPitch(n))); got != n {
+			t.Errorf("note %d round-tripped to %d", n, got)
+		}
+	}
+	if got := SampleToHz(NoteToPitch(69)); got != 440 {
+		t.Errorf("note 69 = %vHz, want 440Hz", got)
+	}
+	c := NewCounter()
+	c.Input("trig", &pulses{n: 100})
+	render(c, 1)
+	if got := c.IntValue(); got != 3 {
+		t.Errorf("counter IntValue = %d, want 3", got)
+	}
+}
+
+func TestMux(t *testing.T) {
+	m := NewMux(3)
+	m.Input("in0", Value(0.2))
+	m.Input("in1", Value(0.6))
+	m.Input("in2", Value(-1))
+	for _, c := range []struct {
+		sel, want Sample
+	}{
+		{0, 0.2}, {1, 0.6}, {2, -1}, {0.25, 0.3}, {0.5, 0.4}, {1.5, -0.2}, {5, -1}, {-1, 0.2},
+	} {
+		m.Input("sel", Value(c.sel))
+		if got := render(m, 1)[0]; !near(got, c.want) {
+			t.Errorf("sel %v: got %v, want %v", c.sel, got, c.want)
+		}
+	}
+
+	// Unselected inputs aren't processed.
+	p := &pulses{n: 1}
+	m.Input("in2", p)
+	m.Input("sel", Value(0.5))
+	render(m, 1)
+	if p.i != 0 {
+		t.Errorf("unselected input was processed")
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Errorf("NewMux(0) did not panic")
+		}
+	}()
+	NewMux(0)
+}
+
+func TestUnconnectedInputs(t *testing.T) {
+	e := NewEnv()
+	for i, v := range render(e, 1) {
+		if v != 0 {
+			t.Fatalf("unconnected Env: sample %d = %v, want 0", i, v)
+		}
+	}
+
+	w := NewWidth()
+	w.Input("width", Value(0))
+	w.Input("width", nil)
+	if got := render(w.width.p, 1)[0]; got != 1 {
+		t.Errorf("disconnected width = %v, want default of 1", got)
+	}
+}
+
+func TestDebounce(t *testing.T) {
+	d := NewDebounce()
+	d.Input("trig", &pulses{n: 30})
+	d.Input("time", Value(50.0/waveHz))
+	got := triggers(render(d, 1))
+	want := []int{0, 60, 120, 180, 240}
+	if !equalInts(got, want) {
+		t.Errorf("triggers at %v, want %v", got, want)
+	}
+}
+
+func TestExpander(t *testing.T) {
+	for _, c := range []struct {
+		in, want Sample
+	}{
+		{0.01, 0.001}, // -40dB in, 20dB below thresh, expanded to -60dB
+		{0.5, 0.5},    // above thresh, untouched
+	} {
+		x := NewExpander()
+		x.Input("in", Value(c.in))
+		x.Input("thresh", Value(-20))
+		x.Input("ratio", Value(2))
+		x.Input("att", Value(0.001))
+		x.Input("rel", Value(0.01))
+		s := render(x, 8)
+		if got := s[len(s)-1]; math.Abs(float64(got-c.want)) > float64(c.want)*0.01 {
+			t.Errorf("in %v: got %v, want %v", c.in, got, c.want)
+		}
+	}
+}
+
+func TestTransient(t *testing.T) {
+	hit := make([]Sample, 4*nSamples)
+	for i := range hit {
+		hit[i] = Sample(math.Sin(2*math.Pi*float64(i)/20) * math.Exp(-float64(i)/2000))
+	}
+	peak := func(attack Sample) (p Sample) {
+		tr := NewTransient()
+		tr.Input("in", &tape{s: hit})
+		tr.Input("attack", Value(attack))
+		for _, v := range render(tr, 1)[:200] {
+			if v > p {
+				p = v
+			}
+		}
+		return p
+	}
+	flat, boosted, cut := peak(0), peak(1), peak(-1)
+	if boosted <= flat*1.1 {
+		t.Errorf("boosted peak %v, want well above unshaped peak %v", boosted, flat)
+	}
+	if cut >= flat*0.9 {
+		t.Errorf("cut peak %v, want well below unshaped peak %v", cut, flat)
+	}
+}
+
+func TestEngineInterleave(t *testing.T) {
+	s := NewStereo()
+	s.Input("left", Value(0.5))
+	s.Input("right", Value(-0.25))
+	e := NewEngine()
+	e.Input("in", s)
+	out := make([]int16, nSamples*nChannels)
+	e.processAudio(nil, out, portaudio.StreamCallbackTimeInfo{}, 0)
+	l, r := toInt16(0.5), toInt16(-0.25)
+	for i := 0; i < len(out); i += 2 {
+		if out[i] != l || out[i+1] != r {
+			t.Fatalf("frame %d = %d, %d, want %d, %d", i/2, out[i], out[i+1], l, r)
+		}
+	}
+
+	// A mono input is played on both channels.
+	e.Input("in", Value(0.5))
+	e.processAudio(nil, out, portaudio.StreamCallbackTimeInfo{}, 0)
+	if out[0] != l || out[1] != l {
+		t.Errorf("mono frame = %d, %d, want %d, %d", out[0], out[1], l, l)
+	}
+}
+
+func TestEngineRender(t *testing.T) {
+	s := NewStereo()
+	s.Input("left", Value(0.5))
+	s.Input("right", Value(-0.25))
+	e := NewEngine()
+	e.Input("in", s)
+
+	var buf bytes.Buffer
+	if err := e.Render(&buf, 2, Format{}); err != nil {
+		t.Fatal(err)
+	}
+	b := buf.Bytes()
+	if want := 2 * nSamples * nChannels * 2; len(b) != want {
+		t.Fatalf("16-bit: wrote %d bytes, want %d", len(b), want)
+	}
+	l, r := uint16(toInt16(0.5)), uint16(toInt16(-0.25))
+	if got := binary.LittleEndian.Uint16(b); got != l {
+		t.Errorf("16-bit: left = %#x, want %#x", got, l)
+	}
+	if got := binary.LittleEndian.Uint16(b[2:]); got != r {
+		t.Errorf("16-bit: right = %#x, want %#x", got, r)
+	}
+
+	buf.Reset()
+	if err := e.Render(&buf, 1, Format{Float: true, Order: binary.BigEndian}); err != nil {
+		t.Fatal(err)
+	}
+	b = buf.Bytes()
+	if want := nSamples * nChannels * 4; len(b) != want {
+		t.Fatalf("float: wrote %d bytes, want %d", len(b), want)
+	}
+	if got, want := binary.BigEndian.Uint32(b), math.Float32bits(0.5); got != want {
+		t.Errorf("float: left = %#x, want %#x", got, want)
+	}
+	if got, want := binary.BigEndian.Uint32(b[4:]), math.Float32bits(-0.25); got != want {
+		t.Errorf("float: right = %#x, want %#x", got, want)
+	}
+}
+
+func TestDevices(t *testing.T) {
+	if err := portaudio.Initialize(); err != nil {
+		t.Skip("portaudio unavailable:", err)
+	}
+	defer portaudio.Terminate()
+	def, err := DefaultDevice()
+	if err != nil {
+		t.Skip("no default audio device:", err)
+	}
+	ds, err := Devices()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, d := range ds {
+		if d.Name == def.Name {
+			return
+		}
+	}
+	t.Errorf("default device %q not in %v", def.Name, ds)
+}
+
+// fakeDevice is a stream that calls back its Engine once per block, as an
+// audio device does, until it is unplugged.
+type fakeDevice struct {
+	e          *Engine
+	unplugged  int32 // atomic
+	quit, done chan bool
+	once       sync.Once
+}
+
+func (d *fakeDevice) Start() error {
+	d.quit, d.done = make(chan bool), make(chan bool)
+	go func() {
+		defer close(d.done)
+		out := make([]int16, nSamples*nChannels)
+		for {
+			select {
+			case <-d.quit:
+				return
+			case <-time.After(blockTime):
+			}
+			if atomic.LoadInt32(&d.unplugged) == 0 {
+				d.e.processAudio(nil, out, portaudio.StreamCallbackTimeInfo{}, 0)
+			}
+		}
+	}()
+	return nil
+}
+
+// Stop returns once the last callback has returned, as portaudio's does.
+func (d *fakeDevice) Stop() error {
+	d.once.Do(func() { close(d.quit) })
+	<-d.done
+	return nil
+}
+
+func (d *fakeDevice) Abort() error                { return d.Stop() }
+func (d *fakeDevice) Close() error                { return nil }
+func (d *fakeDevice) Info() *portaudio.StreamInfo { return &portaudio.StreamInfo{} }
+
+func TestDeviceLost(t *testing.T) {
+	e := NewEngine()
+	e.Input("in", NewSin())
+	var d *fakeDevice
+	e.open = func() (stream, error) {
+		d = &fakeDevice{e: e}
+		return d, nil
+	}
+
+	// A device that keeps calling back is not lost.
+	if err := e.Start(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-e.Lost():
+		t.Fatalf("working device lost: %v", err)
+	case <-time.After(3 * deviceTimeout / 2):
+	}
+	if err := e.Stop(); err != nil {
+		t.Fatalf("stopping working device: %v", err)
+	}
+
+	// An unplugged device is reported, and the Engine can start again.
+	if err := e.Start(); err != nil {
+		t.Fatal(err)
+	}
+	atomic.StoreInt32(&d.unplugged, 1)
+	select {
+	case err := <-e.Lost():
+		if err != ErrDeviceLost {
+			t.Errorf("Lost sent %v, want ErrDeviceLost", err)
+		}
+	case <-time.After(4 * deviceTimeout):
+		t.Fatal("unplugged device not reported")
+	}
+	if err := e.Stop(); err != ErrDeviceLost {
+		t.Errorf("Stop after losing the device returned %v, want ErrDeviceLost", err)
+	}
+	if err := e.Start(); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Stop(); err != nil {
+		t.Errorf("stopping restarted Engine: %v", err)
+	}
+}
+
+// slow is a Processor that takes d to process each block.
+type slow time.Duration
+
+func (d slow) Process(s []Sample) {
+	time.Sleep(time.Duration(d))
+}
+
+func TestUnderruns(t *testing.T) {
+	e := NewEngine()
+	out := make([]int16, nSamples*nChannels)
+	e.processAudio(nil, out, portaudio.StreamCallbackTimeInfo{}, 0)
+	if n := e.Underruns(); n != 0 {
+		t.Errorf("after a fast block, %d underruns, want 0", n)
+	}
+	e.Input("in", slow(2*blockTime))
+	e.processAudio(nil, out, portaudio.StreamCallbackTimeInfo{}, 0)
+	if n := e.Underruns(); n != 1 {
+		t.Errorf("after a slow block, %d underruns, want 1", n)
+	}
+	e.Input("in", Value(0))
+	e.processAudio(nil, out, portaudio.StreamCallbackTimeInfo{}, portaudio.OutputUnderflow)
+	if n := e.Underruns(); n != 2 {
+		t.Errorf("after a device underflow, %d underruns, want 2", n)
+	}
+}
+
+func TestLatency(t *testing.T) {
+	if a, b := latency(256, 0, 0), latency(512, 0, 0); b-2*a > time.Microsecond || 2*a-b > time.Microsecond {
+		t.Errorf("latency for 512 samples = %v, want twice %v", b, a)
+	}
+
+	e := NewEngine()
+	if got := e.Latency(); got != blockTime {
+		t.Errorf("latency = %v, want %v", got, blockTime)
+	}
+	f := NewFeedback()
+	s := NewSum()
+	s.Input("a", NewSin())
+	s.Input("b", f.Return())
+	f.Input("in", s)
+	e.Input("in", f)
+	if got := e.Latency(); got != 2*blockTime {
+		t.Errorf("latency with feedback = %v, want %v", got, 2*blockTime)
+	}
+}
+
+func TestSwap(t *testing.T) {
+	w := NewSwap()
+	w.Input("in", Value(0))
+	w.SwapTo(Value(1))
+	s := render(w, 4)
+	last := Sample(0)
+	for i, v := range s {
+		if d := v - last; d < 0 || d > 1/(swapTime*waveHz)+1e-9 {
+			t.Fatalf("sample %d: stepped from %v to %v", i, last, v)
+		}
+		last = v
+	}
+	if last != 1 || w.old != nil {
+		t.Errorf("after crossfade, output %v and old source %v, want 1 and nil", last, w.old)
+	}
+
+	// Swapping again during a crossfade fades smoothly from the mix.
+	w.Input("in", Value(0))
+	w.SwapTo(Value(1))
+	s = render(w, 1) // part way through the fade
+	w.SwapTo(Value(-1))
+	s = append(s, render(w, 4)...)
+	last = 0
+	for i, v := range s {
+		if d := math.Abs(float64(v - last)); d > 2/(swapTime*waveHz)+1e-9 {
+			t.Fatalf("after two swaps, sample %d: stepped from %v to %v", i, last, v)
+		}
+		last = v
+	}
+	if last != -1 || w.old != nil {
+		t.Errorf("after two swaps, output %v and old source %v, want -1 and nil", last, w.old)
+	}
+}
+
+func TestProfiled(t *testing.T) {
+	pr := NewProfiler()
+	s := NewSum()
+	s.Input("a", pr.Profile("test-sin", NewSin()))
+	s.Input("b", pr.Profile("test-slow", slow(time.Millisecond)))
+	p := pr.Profile("test-sum", s)
+
+	// A second Profiler, as for another Engine, keeps its own accounts.
+	other := NewProfiler()
+	q := other.Profile("other", NewSin())
+	other.SetEnabled(true)
+
+	pr.SetEnabled(true)
+	render(p, 4)
+	render(q, 1)
+
+	r := pr.Report()
+	if len(r) != 3 || r[0].Name != "test-slow" || r[0].Percent < 50 {
+		t.Errorf("report = %v, want test-slow first with the majority of the time", r)
+	}
+	if r := other.Report(); len(r) != 1 || r[0].Name != "other" {
+		t.Errorf("other report = %v, want just other", r)
+	}
+
+	other.Remove(q)
+	if r := other.Report(); len(r) != 0 {
+		t.Errorf("after Remove, report = %v, want none", r)
+	}
+	pr.Reset()
+	if r := pr.Report(); r[0].Total != 0 {
+		t.Errorf("after Reset, report = %v, want no time", r)
+	}
+}
+
+// aliasing returns the fraction of the power of s, a signal with
+// fundamental hz, that lies away from its harmonics.
+func aliasing(s []Sample, hz float64) float64 {
+	const n = 4096
+	s = s[len(s)-n:]
+	cos := make([]float64, n)
+	for i := range cos {
+		cos[i] = math.Cos(2 * math.Pi * float64(i) / n)
+	}
+	var harm, other float64
+	for k := 1; k < n/2; k++ {
+		var re, im float64
+		for i, v := range s {
+			x := float64(v) * hann(2*float64(i)/n-1)
+			re += x * cos[k*i%n]
+			im += x * cos[(k*i+n/4)%n]
+		}
+		f := float64(k) * waveHz / n
+		h := math.Floor(f/hz + 0.5)
+		if h > 0 && math.Abs(f-h*hz) < 4*waveHz/n {
+			harm += re*re + im*im
+		} else {
+			other += re*re + im*im
+		}
+	}
+	return other / (harm + other)
+}
+
+func TestOversample(t *testing.T) {
+	pitch := Value(HzToSample(3100))
+	hz := SampleToHz(Sample(pitch))
+	for _, c := range []struct {
+		name string
+		osc  interface {
+			Processor
+			Sink
+			SetOversample(int)
+		}
+	}{
+		{"square", NewSquare()},
+		{"saw", NewSaw()},
+	} {
+		c.osc.Input("pitch", pitch)
+		naive := aliasing(render(c.osc, 20), hz)
+		c.osc.SetOversample(4)
+		over := aliasing(render(c.osc, 20), hz)
+		if over > naive/4 {
+			t.Errorf("%s: aliasing %.4f with 4x oversampling, %.4f without; want a quarter or less", c.name, over, naive)
+		}
+	}
+
+	for _, n := range []int{-1, 0, 1, 3, 16, 1 << 20} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("NewOversample(%d) did not panic", n)
+				}
+			}()
+			NewOversample(n, NewClip())
+		}()
+	}
+}
+
+func TestOversampleNonlinear(t *testing.T) {
+	pitch := Value(HzToSample(3100))
+	hz := SampleToHz(Sample(pitch))
+	sine := func() Processor {
+		o := NewSin()
+		o.Input("pitch", pitch)
+		m := NewMul()
+		m.Input("a", o)
+		m.Input("b", Value(4))
+		return m
+	}
+
+	c := NewClip()
+	c.Input("in", sine())
+	naive := aliasing(render(c, 20), hz)
+
+	o := NewOversample(8, NewClip())
+	o.Input("in", sine())
+	over := aliasing(render(o, 20), hz)
+
+	if over > naive/4 {
+		t.Errorf("aliasing %.4f with 8x oversampling, %.4f without; want a quarter or less", over, naive)
+	}
+}
+
+func TestOversampleSideInput(t *testing.T) {
+	// The fx renders its side inputs in ordinary blocks.
+	g := NewGain()
+	g.Input("db", Value(-6))
+	o := NewOversample(4, g)
+	o.Input("in", Value(1))
+	s := render(o, 4)
+	if got, want := s[len(s)-1], Sample(DBToLin(-6)); math.Abs(float64(got-want)) > 1e-3 {
+		t.Errorf("oversampled gain of -6dB = %v, want %v", got, want)
+	}
+	for _, fx := range []interface {
+		Processor
+		Sink
+	}{NewLowPass(), NewExpander()} {
+		o := NewOversample(2, fx)
+		o.Input("in", NewSin())
+		render(o, 2)
+	}
+}
+
+func TestPitchHz(t *testing.T) {
+	if hz := SampleToHz(0); hz != 440 {
+		t.Errorf("SampleToHz(0) = %v, want 440", hz)
+	}
+	for _, hz := range []float64{20, 110, 440, 1000, 12345, 20000} {
+		if got := SampleToHz(HzToSample(hz)); math.Abs(got-hz) > hz*1e-5 {
+			t.Errorf("SampleToHz(HzToSample(%v)) = %v", hz, got)
+		}
+	}
+	if p := HzToSample(880); !near(p, 0.1) {
+		t.Errorf("HzToSample(880) = %v, want 0.1", p)
+	}
+}
+
+func TestEngineSeed(t *testing.T) {
+	out := func(seed int64) []byte {
+		clk := NewClock()
+		clk.Input("bpm", Value(6000))
+		r := NewRand()
+		r.Input("min", Value(-1))
+		r.Input("max", Value(1))
+		r.Input("trig", clk)
+		w := NewWalk()
+		w.Input("trig", clk)
+		w.Input("step", Value(0.5))
+		w.Input("lo", Value(-1))
+		w.Input("hi", Value(1))
+		s := NewSum()
+		s.Input("a", r)
+		s.Input("b", w)
+		e := NewEngine()
+		e.Input("in", s)
+		e.Seed(seed)
+		var b bytes.Buffer
+		if err := e.Render(&b, 20, Format{Float: true}); err != nil {
+			t.Fatal(err)
+		}
+		return b.Bytes()
+	}
+	if !bytes.Equal(out(1), out(1)) {
+		t.Error("engines with the same seed rendered different output")
+	}
+	if bytes.Equal(out(1), out(2)) {
+		t.Error("engines with different seeds rendered the same output")
+	}
+
+	// The Seqs of a Song's parts are seeded too.
+	song := func(seed int64) []byte {
+		clk := NewClock()
+		clk.Input("bpm", Value(6000))
+		seq := func() *Seq {
+			return NewSeq([]Step{{Prob: 0.5}, {Pitch: 0.1, Prob: 0.5}})
+		}
+		g := NewSong([]Part{{seq(), 1}, {seq(), 1}})
+		g.Input("clock", clk)
+		e := NewEngine()
+		e.Input("in", g)
+		for _, t := range Tickers(g) {
+			e.AddTicker(t)
+		}
+		e.Seed(seed)
+		var b bytes.Buffer
+		if err := e.Render(&b, 20, Format{Float: true}); err != nil {
+			t.Fatal(err)
+		}
+		return b.Bytes()
+	}
+	if !bytes.Equal(song(1), song(1)) {
+		t.Error("songs with the same seed rendered different output")
+	}
+	if bytes.Equal(song(1), song(2)) {
+		t.Error("songs with different seeds rendered the same output")
+	}
+}
+
+func TestCheckTrigger(t *testing.T) {
+	q := NewSeq([]Step{{Pitch: 0}})
+	for _, c := range []struct {
+		name  string
+		s     Sink
+		input string
+		p     Processor
+		ok    bool
+	}{
+		{"clock to counter", NewCounter(), "trig", NewClock(), true},
+		{"seq eoc to counter", NewCounter(), "trig", q.EOC(), true},
+		{"dup of env eoc to burst", NewBurst(), "trig", NewDup(NewEnv().EOC()).Output(), true},
+		{"value to mul", NewMul(), "a", Value(1), true},
+		{"clock to mul", NewMul(), "a", NewClock(), false},
+		{"env eoc to lowpass", NewLowPass(), "cutoff", NewEnv().EOC(), false},
+		{"seq pitch to counter", NewCounter(), "trig", q.Pitch(), true},
+		{"square to env", NewEnv(), "trig", NewSquare(), true},
+	} {
+		if err := CheckTrigger(c.s, c.input, c.p); (err == nil) != c.ok {
+			t.Errorf("%s: CheckTrigger = %v, want ok %v", c.name, err, c.ok)
+		}
+	}
+}
+
+func TestHaas(t *testing.T) {
+	h := NewHaas()
+	h.Input("in", &tape{s: []Sample{1}})
+	h.Input("delay", Value(0.01))
+	l, r := make([]Sample, nSamples*2), make([]Sample, nSamples*2)
+	h.ProcessStereo(l[:nSamples], r[:nSamples])
+	h.ProcessStereo(l[nSamples:], r[nSamples:])
+	if got, want := triggers(l), []int{0}; !equalInts(got, want) {
+		t.Errorf("left impulse at %v, want %v", got, want)
+	}
+	const lag = 441 // 10ms
+	if got, want := triggers(r), []int{lag}; !equalInts(got, want) {
+		t.Errorf("right impulse at %v, want %v", got, want)
+	} else if !near(r[lag], haasLevel) {
+		t.Errorf("right impulse is %v, want %v", r[lag], haasLevel)
+	}
+}
+
+func TestAnalyzer(t *testing.T) {
+	const size, bin = 1024, 32
+	a := NewAnalyzer(size)
+	o := NewSin()
+	o.Input("pitch", Value(HzToSample(a.BinHz(bin))))
+	a.Input("in", o)
+	render(a, size/nSamples)
+
+	spec := a.Spectrum()
+	if len(spec) != size/2+1 {
+		t.Fatalf("spectrum has %d bins, want %d", len(spec), size/2+1)
+	}
+	if v := spec[bin]; math.Abs(v-1) > 0.05 {
+		t.Errorf("bin %d = %v, want 1", bin, v)
+	}
+	for i, v := range spec {
+		if (i < bin-1 || i > bin+1) && v > spec[bin]/100 {
+			t.Errorf("bin %d = %v, want much less than bin %d = %v", i, v, bin, spec[bin])
+		}
+	}
+}
+
+func TestAnalyzerBadSize(t *testing.T) {
+	for _, size := range []int{-2, 0, 1, 3} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("NewAnalyzer(%d) did not panic", size)
+				}
+			}()
+			NewAnalyzer(size)
+		}()
+	}
+}
+
+func TestTapTempo(t *testing.T) {
+	const beat = waveHz * 60 / 150 // 150bpm
+	at := func(taps ...int) *tape {
+		s := make([]Sample, taps[len(taps)-1]+1)
+		for _, i := range taps {
+			s[i] = 1
+		}
+		return &tape{s: s}
+	}
+	for _, c := range []struct {
+		name string
+		tap  *tape
+		want Sample
+	}{
+		{"one tap", at(0), tapDefault},
+		{"steady", at(0, beat, 2*beat, 3*beat, 4*beat), 150},
+		{"double tap", at(0, beat, 2*beat, 2*beat+beat/3, 3*beat, 4*beat), 150},
+		{"new tempo", at(0, beat, 2*beat, 4*beat, 6*beat), 75},
+	} {
+		tt := NewTapTempo()
+		tt.Input("tap", c.tap)
+		s := render(tt, len(c.tap.s)/nSamples+1)
+		if got := s[len(s)-1]; math.Abs(float64(got-c.want)) > 0.01 {
+			t.Errorf("%s: bpm = %v, want %v", c.name, got, c.want)
+		}
+	}
+}
+
+func TestQuantizeTrig(t *testing.T) {
+	for _, c := range []struct {
+		div        Sample
+		trig, want []int
+	}{
+		{1, []int{1700, 3100}, []int{2000, 3100}},
+		{4, []int{1300, 1400, 2625}, []int{1300, 1500, 2750}},
+	} {
+		s := make([]Sample, 4000)
+		for _, i := range c.trig {
+			s[i] = 1
+		}
+		q := NewQuantizeTrig()
+		q.Input("trig", &tape{s: s})
+		q.Input("clock", &pulses{n: 1000})
+		q.Input("div", Value(c.div))
+		if got := triggers(render(q, 16)); !equalInts(got, c.want) {
+			t.Errorf("div %v: triggers %v at %v, want %v", c.div, c.trig, got, c.want)
+		}
+	}
+}
+
+// gainAt returns the gain in decibels from the "in" input of in to the
+// output of p, for a sine at hz.
+func gainAt(in Sink, p Processor, hz float64, t ...Ticker) float64 {
+	o := NewSin()
+	o.Input("pitch", Value(HzToSample(hz)))
+	in.Input("in", o)
+	s := render(p, 40, t...)
+	var sum float64
+	for _, v := range s[len(s)/2:] {
+		sum += float64(v * v)
+	}
+	return LinToDB(math.Sqrt(2 * sum / float64(len(s)/2)))
+}
+
+func TestGraphicEQ(t *testing.T) {
+	e := NewGraphicEQ(10)
+	if hz := e.Bands()[5]; hz != 1000 {
+		t.Fatalf("band 5 at %vHz, want 1000Hz", hz)
+	}
+	e.SetGain(5, 12)
+	for _, c := range []struct {
+		hz, db float64
+	}{
+		{1000, 12},
+		{100, 0},
+		{10000, 0},
+	} {
+		if db := gainAt(e, e, c.hz); math.Abs(db-c.db) > 0.5 {
+			t.Errorf("gain at %vHz = %.2fdB, want %vdB", c.hz, db, c.db)
+		}
+	}
+}
+
+func TestMultiband(t *testing.T) {
+	m := NewMultiband([]float64{200, 2000})
+	mid := NewSum()
+	mid.Input("a", m.Band(1))
+	mid.Input("b", m.Band(2))
+	sum := NewSum()
+	sum.Input("a", m.Band(0))
+	sum.Input("b", mid)
+	for _, hz := range []float64{50, 200, 630, 2000, 8000} {
+		if db := gainAt(m, sum, hz, m); math.Abs(db) > 0.1 {
+			t.Errorf("sum of bands at %vHz = %.2fdB, want 0dB", hz, db)
+		}
+	}
+	// Each band should carry most of the signal in its own range.
+	for i, hz := range []float64{50, 630, 8000} {
+		if db := gainAt(m, m.Band(i), hz, m); db < -1 {
+			t.Errorf("band %d at %vHz = %.2fdB, want about 0dB", i, hz, db)
+		}
+	}
+}
+
+func TestShelf(t *testing.T) {
+	for _, c := range []struct {
+		name      string
+		f         *Shelf
+		low, high float64 // expected gain at 50Hz and 15kHz
+	}{
+		{"low", NewLowShelf(), 6, 0},
+		{"high", NewHighShelf(), 0, 6},
+	} {
+		c.f.Input("gain", Value(6))
+		for _, hz := range []float64{50, 15000} {
+			want := c.low
+			if hz > 1000 {
+				want = c.high
+			}
+			if db := gainAt(c.f, c.f, hz); math.Abs(db-want) > 0.3 {
+				t.Errorf("%s shelf: gain at %vHz = %.2fdB, want %vdB", c.name, hz, db, want)
+			}
+		}
+	}
+}
+
+func TestVelocity(t *testing.T) {
+	at := func(curve int, vel Sample) Sample {
+		v := NewVelocity()
+		v.Input("vel", Value(vel))
+		v.Input("curve", Value(curve))
+		return render(v, 1)[0]
+	}
+	for _, curve := range []int{VelLinear, VelExp, VelLog} {
+		if lo, hi := at(curve, 0), at(curve, 1); !near(lo, 0) || !near(hi, 1) {
+			t.Errorf("curve %d maps 0 and 1 to %v and %v, want 0 and 1", curve, lo, hi)
+		}
+	}
+	lin, exp, log := at(VelLinear, 0.25), at(VelExp, 0.25), at(VelLog, 0.25)
+	if !near(lin, 0.25) {
+		t.Errorf("linear curve maps 0.25 to %v", lin)
+	}
+	if exp >= lin {
+		t.Errorf("exponential curve maps 0.25 to %v, want less than linear %v", exp, lin)
+	}
+	if log <= lin {
+		t.Errorf("logarithmic curve maps 0.25 to %v, want more than linear %v", log, lin)
+	}
+}
+
+func TestPitchBend(t *testing.T) {
+	defer handleMidi(portmidi.Event{Status: 224, Data1: 0, Data2: 64})
+	b := NewPitchBend()
+	handleMidi(portmidi.Event{Status: 224, Data1: 127, Data2: 127}) // full up
+	s := render(b, 20)
+	if d := s[1] - s[0]; d <= 0 || d > semitone/10 {
+		t.Errorf("bend moved by %v in one sample, want a small rise", d)
+	}
+	want := 440 * math.Pow(2, 2.0/12)
+	if hz := SampleToHz(s[len(s)-1]); math.Abs(hz-want) > 0.01 {
+		t.Errorf("bent 440Hz to %vHz, want %vHz", hz, want)
+	}
+}
+
+func TestMidiControl(t *testing.T) {
+	defer handleMidi(portmidi.Event{Status: 176, Data1: 1, Data2: 0})
+	defer handleMidi(portmidi.Event{Status: 208, Data1: 0})
+	mod, at := NewModWheel(), NewAftertouch()
+	handleMidi(portmidi.Event{Status: 176, Data1: 1, Data2: 64})
+	handleMidi(portmidi.Event{Status: 176, Data1: 7, Data2: 127}) // volume, ignored
+	handleMidi(portmidi.Event{Status: 208, Data1: 127})
+	for _, c := range []struct {
+		name string
+		p    Processor
+		want Sample
+	}{
+		{"mod wheel", mod, Sample(64) / 127},
+		{"aftertouch", at, 1},
+	} {
+		s := render(c.p, 20)
+		if s[0] <= 0 || s[0] > c.want/10 {
+			t.Errorf("%s: first sample %v, want a small rise toward %v", c.name, s[0], c.want)
+		}
+		if v := s[len(s)-1]; math.Abs(float64(v-c.want)) > 1e-3 {
+			t.Errorf("%s: settled at %v, want %v", c.name, v, c.want)
+		}
+	}
+}
+
+func TestMidiReset(t *testing.T) {
+	defer handleMidi(portmidi.Event{Status: 176, Data1: 1, Data2: 0})
+	defer handleMidi(portmidi.Event{Status: 224, Data1: 0, Data2: 64})
+	handleMidi(portmidi.Event{Status: 176, Data1: 1, Data2: 64})
+	handleMidi(portmidi.Event{Status: 224, Data1: 0, Data2: 96})
+	for _, mk := range []func() Processor{
+		func() Processor { return NewModWheel() },
+		func() Processor { return NewPitchBend() },
+	} {
+		p := mk()
+		want := render(mk(), 1)
+		render(p, 20)
+		p.(Resetter).Reset()
+		if got := render(p, 1); !equalSamples(got, want) {
+			t.Errorf("%T after Reset starts at %v, want %v", p, got[0], want[0])
+		}
+	}
+
+	// A reset MidiNote starts at the current note, rather than gliding
+	// to it from the last.
+	defer SetLegato(false)
+	defer handleMidi(portmidi.Event{Status: 128, Data1: 72})
+	defer handleMidi(portmidi.Event{Status: 128, Data1: 60})
+	SetLegato(true)
+	n := NewMidiNote()
+	n.Input("glide", Value(0.1))
+	handleMidi(portmidi.Event{Status: 144, Data1: 60, Data2: 100})
+	render(n, 1)
+	handleMidi(portmidi.Event{Status: 144, Data1: 72, Data2: 100})
+	n.Reset()
+	if v := render(n, 1)[0]; v != NoteToPitch(72) {
+		t.Errorf("MidiNote after Reset starts at %v, want %v", v, NoteToPitch(72))
+	}
+}
+
+func TestNotePriority(t *testing.T) {
+	defer SetNotePriority(LastNote)
+	for _, c := range []struct {
+		p      NotePriority
+		events []int64 // note numbers, negated for note off
+		want   []int   // sounding note after each event
+		retrig int
+	}{
+		{LastNote, []int64{60, 64, 62, -62, -64}, []int{60, 64, 62, 64, 60}, 3},
+		{HighestNote, []int64{60, 64, 62, -64, -62}, []int{60, 64, 64, 62, 60}, 2},
+		{LowestNote, []int64{64, 60, 62, -60, -62}, []int{64, 60, 60, 62, 64}, 2},
+	} {
+		SetNotePriority(c.p)
+		g := NewMidiGate()
+		var got []int
+		retrig := 0
+		for _, n := range c.events {
+			e := portmidi.Event{Status: 144, Data1: n, Data2: 100}
+			if n < 0 {
+				e = portmidi.Event{Status: 128, Data1: -n}
+			}
+			handleMidi(e)
+			got = append(got, NewMidiNote().IntValue())
+			if s := render(g, 1); s[0] == 0 && s[1] == 1 {
+				retrig++
+			}
+		}
+		handleMidi(portmidi.Event{Status: 128, Data1: 60})
+		handleMidi(portmidi.Event{Status: 128, Data1: 64})
+		if !equalInts(got, c.want) {
+			t.Errorf("priority %d: notes %v, want %v", c.p, got, c.want)
+		}
+		if retrig != c.retrig {
+			t.Errorf("priority %d: %d retriggers, want %d", c.p, retrig, c.retrig)
+		}
+	}
+}
+
+func TestSlew(t *testing.T) {
+	l := NewSlew()
+	l.Input("in", Value(1))
+	l.Input("time", Value(0.01)) // 441 samples
+	s := render(l, 2)
+	if v := s[440]; math.Abs(float64(v)-(1-1/math.E)) > 0.01 {
+		t.Errorf("after the slew time, output %v, want about %v", v, 1-1/math.E)
+	}
+	l.Input("time", Value(0))
+	if s := render(l, 1); s[0] != 1 {
+		t.Errorf("with no slew time, output %v, want 1", s[0])
+	}
+}
+
+func TestLegato(t *testing.T) {
+	SetLegato(true)
+	defer SetLegato(false)
+	note, gate := NewMidiNote(), NewMidiGate()
+	note.Input("glide", Value(0.05))
+	play := func(e portmidi.Event) (n, g []Sample) {
+		handleMidi(e)
+		return render(note, 1), render(gate, 1)
+	}
+	on := func(n int64) portmidi.Event { return portmidi.Event{Status: 144, Data1: n, Data2: 100} }
+	off := func(n int64) portmidi.Event { return portmidi.Event{Status: 128, Data1: n} }
+
+	n, g := play(on(60))
+	if g[0] != 0 || g[1] != 1 || n[0] != NoteToPitch(60) {
+		t.Errorf("first note: gate %v, pitch %v; want a trigger and note 60", g[:2], n[0])
+	}
+	n, g = play(on(64))
+	if g[0] != 1 {
+		t.Error("overlapping note retriggered the gate")
+	}
+	if n[0] <= NoteToPitch(60) || n[len(n)-1] >= NoteToPitch(64) {
+		t.Errorf("overlapping note: pitch went from %v to %v, want a glide from note 60 toward 64", n[0], n[len(n)-1])
+	}
+	play(off(64))
+	play(off(60))
+	n, g = play(on(67))
+	if g[0] != 0 || g[1] != 1 || n[0] != NoteToPitch(67) {
+		t.Errorf("separate note: gate %v, pitch %v; want a trigger and note 67", g[:2], n[0])
+	}
+	play(off(67))
+}
+
+func TestFineTune(t *testing.T) {
+	f := NewFineTune()
+	f.Input("cents", Value(100))
+	want := 440 * math.Pow(2, 1.0/12)
+	if hz := SampleToHz(render(f, 1)[0]); math.Abs(hz-want) > 0.01 {
+		t.Errorf("+100 cents from 440Hz = %vHz, want %vHz", hz, want)
+	}
+
+	// Two sines 10 cents apart beat at the difference in frequency.
+	f.Input("cents", Value(10))
+	a, b := NewSin(), NewSin()
+	b.Input("pitch", f)
+	sum := NewSum()
+	sum.Input("a", a)
+	sum.Input("b", b)
+	s := render(sum, waveHz/nSamples)
+	peak := func(at float64) (max Sample) {
+		i := int(at * waveHz)
+		for _, v := range s[i : i+waveHz/200] {
+			if v > max {
+				max = v
+			}
+		}
+		return
+	}
+	beat := SampleToHz(10*cent) - SampleToHz(0)
+	if p := peak(0); p < 1.9 {
+		t.Errorf("peak at start = %v, want about 2", p)
+	}
+	if p := peak(1/(2*beat) - 0.0025); p > 0.3 {
+		t.Errorf("peak half a beat in = %v, want about 0", p)
+	}
+}
+
+func TestSHNoise(t *testing.T) {
+	steps := func(seed int64) []Sample {
+		n := NewSHNoise()
+		n.Seed(seed)
+		n.Input("trig", &pulses{n: 100})
+		s := render(n, 4)
+		var v []Sample
+		for i := 0; i+100 <= len(s); i += 100 {
+			if s[i] < -1 || s[i] > 1 {
+				t.Errorf("value %v out of range -1 to 1", s[i])
+			}
+			if s[i+99] != s[i] {
+				t.Errorf("value not held between triggers: %v then %v", s[i], s[i+99])
+			}
+			v = append(v, s[i])
+		}
+		return v
+	}
+	a, b := steps(7), steps(7)
+	for i := range a {
+		if a[i] != b[i] {
+			t.Fatalf("with the same seed, step %d is %v and %v", i, a[i], b[i])
+		}
+	}
+	if a[0] == a[1] {
+		t.Errorf("first two steps are both %v, want fresh values", a[0])
+	}
+}
+
+func TestClockMul(t *testing.T) {
+	c := NewClockMul()
+	c.Input("clock", &pulses{n: 1000})
+	c.Input("mult", Value(4))
+	// The first clock passes alone, as there is no interval to divide.
+	want := []int{0}
+	for i := 1000; i < 4096; i += 250 {
+		want = append(want, i)
+	}
+	if got := triggers(render(c, 16)); !equalInts(got, want) {
+		t.Errorf("triggers at %v, want %v", got, want)
+	}
+}
+
+func TestPingPong(t *testing.T) {
+	p := NewPingPong()
+	p.Input("in", &tape{s: []Sample{1}})
+	p.Input("time", Value(0.01)) // 441 samples
+	p.Input("fb", Value(0.5))
+	p.Input("mix", Value(1))
+	const blocks = 8
+	l, r := make([]Sample, blocks*nSamples), make([]Sample, blocks*nSamples)
+	for i := 0; i < blocks; i++ {
+		p.ProcessStereo(l[i*nSamples:(i+1)*nSamples], r[i*nSamples:(i+1)*nSamples])
+	}
+	for _, c := range []struct {
+		ch   string
+		s    []Sample
+		want map[int]Sample
+	}{
+		{"left", l, map[int]Sample{441: 1, 1323: 0.25}},
+		{"right", r, map[int]Sample{882: 0.5, 1764: 0.125}},
+	} {
+		for i, v := range c.s {
+			if want := c.want[i]; !near(v, want) {
+				t.Errorf("%s[%d] = %v, want %v", c.ch, i, v, want)
+			}
+		}
+	}
+}
+
+func TestStereoDelay(t *testing.T) {
+	d := NewStereoDelay()
+	d.Input("in", &tape{s: []Sample{1}})
+	d.Input("timeL", Value(0.01))  // 441 samples
+	d.Input("timeR", Value(0.025)) // 1102.5 samples
+	d.Input("fb", Value(0.5))
+	d.Input("mix", Value(1))
+	const blocks = 8
+	l, r := make([]Sample, blocks*nSamples), make([]Sample, blocks*nSamples)
+	for i := 0; i < blocks; i++ {
+		d.ProcessStereo(l[i*nSamples:(i+1)*nSamples], r[i*nSamples:(i+1)*nSamples])
+	}
+	for _, c := range []struct {
+		ch   string
+		s    []Sample
+		want map[int]Sample
+	}{
+		{"left", l, map[int]Sample{441: 1, 882: 0.5, 1323: 0.25, 1764: 0.125}},
+		{"right", r, map[int]Sample{1102: 0.5, 1103: 0.5}},
+	} {
+		for i, v := range c.s {
+			if want := c.want[i]; !near(v, want) {
+				t.Errorf("%s[%d] = %v, want %v", c.ch, i, v, want)
+			}
+		}
+	}
+}
+
+func TestDecimate(t *testing.T) {
+	ramp := make([]Sample, 1000)
+	for i := range ramp {
+		ramp[i] = Sample(i)
+	}
+	d := NewDecimate()
+	d.Input("in", &tape{s: ramp})
+	d.Input("rate", Value(waveHz/10))
+	s := render(d, 4)[:len(ramp)]
+	for i, v := range s {
+		if want := Sample(i - i%10); v != want {
+			t.Fatalf("output[%d] = %v, want %v", i, v, want)
+		}
+	}
+
+	// Above the sample rate every sample is taken, and the phase wraps.
+	d = NewDecimate()
+	d.Input("in", &tape{s: ramp})
+	d.Input("rate", Value(4*waveHz))
+	s = render(d, 40)
+	if !equalSamples(s[:len(ramp)], ramp) {
+		t.Errorf("at 4x the sample rate, output %v..., want the input", s[:4])
+	}
+	if d.phase < 0 || d.phase >= waveHz {
+		t.Errorf("phase %v outside [0, %v)", d.phase, waveHz)
+	}
+}
+
+func TestFeedbackLoop(t *testing.T) {
+	// out = 1 + out/2, one block late, which settles at 2.
+	f := NewFeedback()
+	half := NewMul()
+	half.Input("a", f.Return())
+	half.Input("b", Value(0.5))
+	s := NewSum()
+	s.Input("a", Value(1))
+	s.Input("b", half)
+	f.Input("in", s)
+	if err := CheckLoops(f); err != nil {
+		t.Fatalf("CheckLoops: %v", err)
+	}
+	out := render(f, 60)
+	for i := 1; i < len(out); i++ {
+		if out[i] < out[i-1] || out[i] > 2 {
+			t.Fatalf("sample %d: %v after %v, want a steady rise toward 2", i, out[i], out[i-1])
+		}
+	}
+	if v := out[len(out)-1]; !near(v, 2) {
+		t.Errorf("loop settled at %v, want 2", v)
+	}
+
+	loop := NewSum()
+	loop.Input("b", NewDup(loop).Output())
+	if err := CheckLoops(loop); err == nil {
+		t.Error("CheckLoops found no error in a loop without a Feedback")
+	}
+}
+
+// countTriggers is a module, built as one outside the package would be,
+// that outputs the number of triggers it has seen.
+type countTriggers struct {
+	in Processor
+	t  Trigger
+	n  int
+}
+
+func (c *countTriggers) Process(s []Sample) {
+	c.in.Process(s)
+	for i, v := range s {
+		if c.t.Next(v) {
+			c.n++
+		}
+		s[i] = Sample(c.n)
+	}
+}
+
+func TestTrigger(t *testing.T) {
+	// A gate held high fires once, as does a single-sample trigger.
+	in := []Sample{0, 1, 1, 1, 0, 0, 1, 0, 0.5, 0.6, 2, -1}
+	c := &countTriggers{in: &tape{s: in}}
+	s := render(c, 1)
+	want := []Sample{0, 1, 1, 1, 1, 1, 2, 2, 2, 3, 3, 3}
+	for i, w := range want {
+		if s[i] != w {
+			t.Errorf("after sample %d, %v triggers, want %v", i, s[i], w)
+		}
+	}
+}
+
+func TestAutomate(t *testing.T) {
+	saw := NewSaw()
+	saw.Input("pitch", Value(-0.1)) // 220Hz
+	f := NewLowPass()
+	f.Input("in", saw)
+	f.Input("cutoff", Value(-0.3))
+	e := NewEngine()
+	e.Input("in", f)
+	err := Automate(f, []AutomationEvent{
+		{Time: 1, Input: "cutoff", Value: 0.5, Ramp: true},
+		{Time: 0.25, Input: "cutoff", Value: 0},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Automate(f, []AutomationEvent{{Input: "bogus"}}); err == nil {
+		t.Error("automating an unknown input succeeded")
+	}
+	var b bytes.Buffer
+	if err := e.Render(&b, waveHz/nSamples+1, Format{Float: true}); err != nil {
+		t.Fatal(err)
+	}
+	pcm := make([]float32, b.Len()/4)
+	binary.Read(&b, binary.LittleEndian, pcm)
+
+	// The energy of the changes between samples rises with the cutoff.
+	var last float64
+	for i, c := range []struct {
+		start, end float64 // seconds
+		cutoff     string
+	}{
+		{0, 0.25, "-0.3"},
+		{0.25, 0.5, "0 to 0.17"},
+		{0.75, 1, "0.33 to 0.5"},
+	} {
+		var sum float64
+		for j := int(c.start*waveHz) + 1; j < int(c.end*waveHz); j++ {
+			d := float64(pcm[j*nChannels] - pcm[(j-1)*nChannels])
+			sum += d * d
+		}
+		if i > 0 && sum < 2*last {
+			t.Errorf("from %vs to %vs, at cutoff %v, high frequency energy %v, want well above %v", c.start, c.end, c.cutoff, sum, last)
+		}
+		last = sum
+	}
+}
+
+func TestModMatrix(t *testing.T) {
+	m := NewModMatrix()
+	dst := NewSum()
+	dst.Input("a", Value(0.1))
+	m.Route(Value(1), dst, "a", 0.5)
+	m.Route(Value(0.4), dst, "a", 0.5)
+	m.Route(Value(0.4), dst, "a", 0.25) // changes the depth
+	if v := render(dst, 1, m)[0]; !near(v, 0.1+0.5+0.1) {
+		t.Errorf("destination = %v, want %v", v, 0.1+0.5+0.1)
+	}
+
+	// A source routed twice is rendered once per block.
+	ramp := make([]Sample, 2*nSamples)
+	for i := range ramp {
+		ramp[i] = Sample(i)
+	}
+	src := &tape{s: ramp}
+	sum := NewSum()
+	m.Route(src, sum, "a", 1)
+	m.Route(src, sum, "b", -0.5)
+	s := render(sum, 2, m)
+	for i, v := range s {
+		if want := ramp[i] / 2; v != want {
+			t.Fatalf("sum[%d] = %v, want %v", i, v, want)
+		}
+	}
+}
+
+func TestReverb(t *testing.T) {
+	r := NewReverb()
+	r.Input("in", &tape{s: []Sample{1}})
+	r.Input("mix", Value(0.5))
+	const blocks = 100
+	l, rr := make([]Sample, blocks*nSamples), make([]Sample, blocks*nSamples)
+	for i := 0; i < blocks; i++ {
+		r.ProcessStereo(l[i*nSamples:(i+1)*nSamples], rr[i*nSamples:(i+1)*nSamples])
+	}
+
+	// The dry impulse is heard at once on both channels, and nothing
+	// else until the shortest comb delay.
+	if l[0] != 0.5 || rr[0] != 0.5 {
+		t.Errorf("first samples = %v, %v, want 0.5", l[0], rr[0])
+	}
+	for i := 1; i < reverbCombs[0]; i++ {
+		if l[i] != 0 || rr[i] != 0 {
+			t.Fatalf("output at %d before the first reflection", i)
+		}
+	}
+
+	// The tails are decorrelated.
+	var lr, ll, rrr float64
+	for i := 2 * reverbCombs[len(reverbCombs)-1]; i < len(l); i++ {
+		lr += float64(l[i] * rr[i])
+		ll += float64(l[i] * l[i])
+		rrr += float64(rr[i] * rr[i])
+	}
+	if ll == 0 || rrr == 0 {
+		t.Fatal("no reverb tail")
+	}
+	if c := lr / math.Sqrt(ll*rrr); math.Abs(c) > 0.3 {
+		t.Errorf("correlation of the tails is %.2f, want near 0", c)
+	}
+}
+
+func TestSetPhase(t *testing.T) {
+	a, b := NewSin(), NewSin()
+	b.SetPhase(0.25)
+	if va, vb := render(a, 1)[0], render(b, 1)[0]; !near(va, 0) || !near(vb, 1) {
+		t.Errorf("sin first samples = %v, %v, want 0, 1", va, vb)
+	}
+
+	sq := NewSquare()
+	sq.SetPhase(0.75)
+	saw := NewSaw()
+	saw.SetPhase(0.5)
+	if v := render(sq, 1)[0]; v != -1 {
+		t.Errorf("square first sample = %v, want -1", v)
+	}
+	if v := render(saw, 1)[0]; math.Abs(float64(v)) > 0.05 {
+		t.Errorf("saw first sample = %v, want 0", v)
+	}
+
+	// A sync trigger resets to the start phase.
+	b.Input("syn", &tape{s: []Sample{0, 0, 0, 1}})
+	if v := render(b, 1)[3]; !near(v, 1) {
+		t.Errorf("sin after sync = %v, want 1", v)
+	}
+}
+
+func TestFreeRunning(t *testing.T) {
+	syn := []Sample{0, 0, 0, 0, 1}
+	o := NewSaw()
+	o.Input("syn", &tape{s: syn})
+	synced := render(o, 1)
+	o = NewSaw()
+	o.SetFree(true)
+	o.Input("syn", &tape{s: syn})
+	free := render(o, 1)
+	if synced[4] >= synced[3] {
+		t.Errorf("synced saw did not reset: %v", synced[:5])
+	}
+	if free[4] <= free[3] {
+		t.Errorf("free-running saw reset: %v", free[:5])
+	}
+}
+
+func TestEnvRetrigger(t *testing.T) {
+	const (
+		step = 0.01                     // level change per sample
+		time = 1 / (step * waveHz * 10) // att and dec
+	)
+	gate := func(from, to int) []Sample {
+		g := make([]Sample, nSamples)
+		for i := from; i < to; i++ {
+			g[i] = 1
+		}
+		return g
+	}
+	for _, c := range []struct {
+		name       string
+		gate, trig []Sample
+		want       map[int]Sample // level at sample
+	}{
+		{
+			name: "gate only",
+			gate: gate(10, 40),
+			// Rises while the gate is high and releases when it
+			// falls, without finishing the attack.
+			want: map[int]Sample{10: 0.01, 39: 0.3, 40: 0.29, 69: 0, 100: 0},
+		},
+		{
+			name: "trig only",
+			trig: []Sample{10: 1},
+			// Plays the whole attack and decay.
+			want: map[int]Sample{10: 0.01, 109: 1, 110: 0.99, 208: 0.01, 209: 0},
+		},
+		{
+			name: "gate and trig",
+			gate: gate(10, 150),
+			trig: []Sample{10: 1, 130: 1},
+			// Attacks to 1 and holds; the trigger while sustaining
+			// restarts the attack from 1, and the gate falling
+			// releases.
+			want: map[int]Sample{109: 1, 129: 1, 130: 1, 149: 1, 150: 0.99},
+		},
+		{
+			name: "retrigger mid-decay",
+			trig: []Sample{0: 1, 150: 1},
+			// Restarts the attack from the current level.
+			want: map[int]Sample{149: 0.5, 150: 0.51, 198: 0.99, 199: 1},
+		},
+	} {
+		e := NewEnv()
+		if c.gate != nil {
+			e.Input("gate", &tape{s: c.gate})
+		}
+		if c.trig != nil {
+			e.Input("trig", &tape{s: c.trig})
+		}
+		e.Input("att", Value(time))
+		e.Input("dec", Value(time))
+		s := render(e, 1)
+		for i, want := range c.want {
+			if math.Abs(float64(s[i]-want)) > 1e-4 {
+				t.Errorf("%s: level at %d = %v, want %v", c.name, i, s[i], want)
+			}
+		}
+	}
+}
+
+func TestEnvSustain(t *testing.T) {
+	for _, level := range []Sample{1, 0.5, 0.3333} {
+		e := NewEnv()
+		e.Input("gate", Value(level))
+		e.Input("att", Value(0.0007))
+		e.Input("dec", Value(0.0013))
+		s := render(e, 64)
+		tail := s[len(s)/2:]
+		for i, v := range tail {
+			if v != level {
+				t.Fatalf("gate %v: sustain sample %d = %v", level, i, v)
+			}
+		}
+	}
+}
+
+func TestDupShared(t *testing.T) {
+	// A module that modifies its input buffer doesn't affect the other
+	// outputs, whether they are read as a Processor or a source.
+	d := NewDup(Value(1))
+	inv := NewInvert()
+	inv.Input("in", d.Output())
+	m := NewMul()
+	m.Input("a", Value(1))
+	m.Input("b", d.Output())
+	s := NewSum()
+	s.Input("a", inv)
+	s.Input("b", m)
+	if v := render(s, 1)[0]; v != 0 {
+		t.Errorf("sum = %v, want 0", v)
+	}
+	other := d.Output()
+	if v := render(other, 1)[0]; v != 1 {
+		t.Errorf("third output = %v, want 1", v)
+	}
+}
+
+func TestDupPrivate(t *testing.T) {
+	// A lone output that modifies its buffer doesn't affect an output
+	// added later in the same block.
+	d := NewDup(NewSin())
+	m := NewMul()
+	m.Input("a", d.Output())
+	m.Input("b", Value(0))
+	if v := render(m, 1)[nSamples-1]; v != 0 {
+		t.Errorf("muted output = %v, want 0", v)
+	}
+	want := render(NewSin(), 1)
+	if got := render(d.Output(), 1); !equalSamples(got, want) {
+		t.Errorf("second output = %v..., want %v...", got[:4], want[:4])
+	}
+	s := NewSum()
+	s.Input("a", Value(0))
+	s.Input("b", d.Output())
+	if got := render(s, 1); !equalSamples(got, want) {
+		t.Errorf("output read as a source = %v..., want %v...", got[:4], want[:4])
+	}
+}
+
+func TestDelayLine(t *testing.T) {
+	d := newDelayLine(4)
+	for i := 1; i <= 11; i++ { // wraps around the buffer twice
+		d.Write(Sample(i))
+	}
+	for _, c := range []struct {
+		delay float64
+		want  Sample
+	}{
+		{0, 11},
+		{1, 10},
+		{2.5, 8.5},
+		{3.25, 7.75},
+		{4, 7},
+		{5, 7}, // clamped to the longest delay
+		{-1, 11},
+	} {
+		if got := d.ReadFrac(c.delay); !near(got, c.want) {
+			t.Errorf("ReadFrac(%v) = %v, want %v", c.delay, got, c.want)
+		}
+	}
+}
+
+func TestClockTransport(t *testing.T) {
+	run := make([]Sample, 4*nSamples)
+	for i := range run {
+		if i < 250 || i >= 450 {
+			run[i] = 1
+		}
+	}
+	c := NewClock()
+	c.Input("bpm", Value(waveHz*60/100)) // 100 samples per beat
+	c.Input("run", &tape{s: run})
+	c.Input("reset", &tape{s: []Sample{670: 1}})
+	d := NewDup(c)
+	q := NewSeq([]Step{{Pitch: 1, Prob: 1}, {Pitch: 2, Prob: 1}, {Pitch: 3, Prob: 1}})
+	q.Input("clock", d.Output())
+	q.Input("reset", c.ResetOut())
+	beats := d.Output()
+
+	var clock, pitch []Sample
+	for i := 0; i < 4; i++ {
+		// Render the clock first, so that its ResetOut is current.
+		clock = append(clock, render(beats, 1)...)
+		pitch = append(pitch, render(q.Pitch(), 1, q, d)...)
+	}
+
+	// Stopping at 250, halfway through a beat, and running again at 450
+	// resumes it where it left off; the reset at 670 plays the first
+	// beat at once.
+	want := []int{0, 100, 200, 500, 600, 670, 770}
+	if got := triggers(clock)[:len(want)]; !equalInts(got, want) {
+		t.Errorf("beats at %v, want %v", got, want)
+	}
+	for i, want := range map[int]Sample{600: 2, 669: 2, 670: 1, 770: 2} {
+		if pitch[i] != want {
+			t.Errorf("seq pitch at %d = %v, want %v", i, pitch[i], want)
+		}
+	}
+}
+
+func TestRenderTail(t *testing.T) {
+	r := NewReverb()
+	r.Input("in", &tape{s: []Sample{1}})
+	r.Input("size", Value(0.9))
+	e := NewEngine()
+	e.Input("in", r)
+
+	var b bytes.Buffer
+	tail := Tail{Threshold: 0.0001, Hold: 50 * time.Millisecond}
+	if err := e.RenderTail(&b, 1, Format{Float: true}, tail); err != nil {
+		t.Fatal(err)
+	}
+	pcm := make([]float32, b.Len()/4)
+	binary.Read(&b, binary.LittleEndian, pcm)
+
+	// The render runs well past the single block of content, and stops
+	// once the tail has been silent for the hold time: the last block
+	// before the hold is above the threshold, and those after below it.
+	n := len(pcm) / nChannels
+	if n < waveHz/2 {
+		t.Fatalf("rendered %d samples, want the tail to last at least half a second", n)
+	}
+	hold := int((tail.Hold + blockTime - 1) / blockTime)
+	block := func(i int) []float32 {
+		return pcm[i*nSamples*nChannels : (i+1)*nSamples*nChannels]
+	}
+	blocks := n / nSamples
+	if p := peakF32(block(blocks - hold - 1)); p < 0.0001 {
+		t.Errorf("block before the hold peaks at %v, below the threshold", p)
+	}
+	for i := blocks - hold; i < blocks; i++ {
+		if p := peakF32(block(i)); p >= 0.0001 {
+			t.Errorf("block %d of the hold peaks at %v, above the threshold", i, p)
+		}
+	}
+
+	// The render stops at the maximum length even if the output doesn't
+	// fall silent.
+	e.Input("in", Value(1))
+	b.Reset()
+	if err := e.RenderTail(&b, 1, Format{Float: true}, Tail{Max: 100 * time.Millisecond}); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := b.Len()/4/nChannels, (1+int(100*time.Millisecond/blockTime))*nSamples; got != want {
+		t.Errorf("unending tail rendered %d samples, want %d", got, want)
+	}
+}
+
+func peakF32(s []float32) float64 {
+	var p float64
+	for _, v := range s {
+		p = math.Max(p, math.Abs(float64(v)))
+	}
+	return p
+}
+
+func TestTestSignals(t *testing.T) {
+	trig := &tape{s: []Sample{5: 1, 6: 1, 7: 0, 300: 1}}
+	m := NewImpulse()
+	m.Input("trig", trig)
+	imp := render(m, 2)
+	if got, want := triggers(imp), []int{5, 300}; !equalInts(got, want) {
+		t.Errorf("impulses at %v, want %v", got, want)
+	}
+	for i, v := range imp {
+		if v != 0 && v != 1 {
+			t.Fatalf("impulse[%d] = %v", i, v)
+		}
+	}
+
+	u := NewUnitStep()
+	u.Input("trig", &tape{s: []Sample{5: 1, 6: 0}})
+	for i, v := range render(u, 2) {
+		want := Sample(0)
+		if i >= 5 {
+			want = 1
+		}
+		if v != want {
+			t.Fatalf("step[%d] = %v, want %v", i, v, want)
+		}
+	}
+
+	// Z1 shifts an impulse by one sample, including across blocks.
+	m = NewImpulse()
+	m.Input("trig", &tape{s: []Sample{0: 1, nSamples - 1: 1}})
+	z := NewZ1()
+	z.Input("in", m)
+	if got, want := triggers(render(z, 2)), []int{1, nSamples}; !equalInts(got, want) {
+		t.Errorf("delayed impulses at %v, want %v", got, want)
+	}
+}
+
+func TestWetDry(t *testing.T) {
+	in := make([]Sample, nSamples)
+	for i := range in {
+		in[i] = Sample(i%7) - 3
+	}
+	for _, mix := range []Sample{0, 0.25, 1} {
+		w := NewWetDry(NewSoftClip())
+		w.Input("in", &tape{s: in})
+		w.Input("mix", Value(mix))
+		for i, v := range render(w, 1) {
+			wet := Sample(math.Tanh(float64(in[i])))
+			want := in[i]*(1-mix) + wet*mix
+			if (mix == 0 || mix == 1) && v != want || !near(v, want) {
+				t.Fatalf("mix %v: sample %d = %v, want %v", mix, i, v, want)
+			}
+		}
+	}
+}
+
+func TestGain(t *testing.T) {
+	for _, c := range []struct {
+		db, want Sample
+	}{
+		{0, 0.5},
+		{6, 0.998},
+		{-6, 0.2506},
+		{-20, 0.05},
+	} {
+		g := NewGain()
+		g.Input("in", Value(0.5))
+		g.Input("db", Value(c.db))
+		if v := render(g, 1)[0]; math.Abs(float64(v-c.want)) > 0.005 {
+			t.Errorf("%vdB: output = %v, want %v", c.db, v, c.want)
+		}
+	}
+	if v := DBToLin(LinToDB(0.3)); math.Abs(v-0.3) > 1e-9 {
+		t.Errorf("DBToLin(LinToDB(0.3)) = %v", v)
+	}
+}
+
+func TestLFOSync(t *testing.T) {
+	for _, c := range []struct {
+		div    Sample
+		cycles int // per beat
+	}{
+		{1.0 / 4, 1},
+		{1.0 / 8, 2},
+		{1.0 / 12, 3},
+		{1.0 / 2, 0}, // half a cycle per beat
+	} {
+		o := NewLFO()
+		o.Input("rate", Value(1000)) // ignored once synced
+		o.Input("clock", &pulses{n: 512})
+		o.Input("div", Value(c.div))
+		s := render(o, 12)
+		// Count the rising zero crossings over four beats, after the
+		// clock has been measured.
+		n := 0
+		for i := 1024; i < 1024+4*512; i++ {
+			if s[i-1] < 0 && s[i] >= 0 {
+				n++
+			}
+		}
+		want := 4 * c.cycles
+		if c.cycles == 0 {
+			want = 2
+		}
+		if n != want {
+			t.Errorf("div %.3f: %d cycles in four beats, want %d", c.div, n, want)
+		}
+	}
+}
+
+func TestSharedReset(t *testing.T) {
+	c := NewClock()
+	c.Input("bpm", Value(waveHz*60/512)) // 512 samples per beat
+	c.Input("reset", &tape{s: []Sample{3000: 1}})
+	d := NewDup(c)
+	beats := d.Output()
+	var lfos []*LFO
+	for _, div := range []Sample{1.0 / 4, 1.0 / 12} {
+		o := NewLFO()
+		o.Input("clock", d.Output())
+		o.Input("div", Value(div))
+		o.Input("reset", c.ResetOut())
+		lfos = append(lfos, o)
+	}
+	// Detune the second LFO's phase, as a patch drifting out of
+	// alignment would.
+	render(beats, 1)
+	render(lfos[1], 1)
+	d.Tick()
+	lfos[1].pos += 0.3
+
+	var out [2][]Sample
+	for b := 1; b < 16; b++ {
+		render(beats, 1)
+		for i, o := range lfos {
+			out[i] = append(out[i], render(o, 1)...)
+		}
+		d.Tick()
+	}
+	// Both LFOs restart at phase 0 on the reset, 3000-256 samples into
+	// out, and so cross zero together on each beat after it.
+	for _, i := range []int{3000 - 256, 3000 - 256 + 512, 3000 - 256 + 1024} {
+		for j := range lfos {
+			if v := out[j][i]; math.Abs(float64(v)) > 0.05 { // within a sample
+				t.Errorf("lfo %d at %d = %v, want 0", j, i, v)
+			}
+		}
+	}
+}
+
+func TestParam(t *testing.T) {
+	p := NewParam(1)
+	p.SetAt(300, 3) // in the second block
+	p.SetAt(100, 2)
+	p.SetAt(100, 4) // replaces the 2 at the same sample
+	s := render(p, 2)
+	for i, v := range s {
+		want := Sample(1)
+		switch {
+		case i >= 300:
+			want = 3
+		case i >= 100:
+			want = 4
+		}
+		if v != want {
+			t.Fatalf("sample %d = %v, want %v", i, v, want)
+		}
+	}
+	p.Set(5)
+	if s := render(p, 1); s[0] != 5 || p.Value() != 5 {
+		t.Errorf("after Set(5): first sample %v, Value %v", s[0], p.Value())
+	}
+
+	// Through a Dup, a Param feeds several inputs on one schedule.
+	p = NewParam(0)
+	p.SetAt(nSamples+10, 1)
+	d := NewDup(p)
+	m := NewSum()
+	m.Input("a", d.Output())
+	m.Input("b", d.Output())
+	if s := render(m, 2, d); s[nSamples+9] != 0 || s[nSamples+10] != 2 {
+		t.Errorf("sum of duplicated Param around its change = %v, %v, want 0, 2", s[nSamples+9], s[nSamples+10])
+	}
+}
+
+func TestParamConcurrent(t *testing.T) {
+	// One goroutine sets increasing values while another reads the
+	// Param's value, as the audio thread renders it.
+	const n = 1000
+	p := NewParam(0)
+	done := make(chan bool)
+	go func() {
+		for i := 1; i <= n; i++ {
+			p.Set(Sample(i))
+		}
+		done <- true
+	}()
+	go func() {
+		for last := Sample(0); last < n; {
+			v := p.Value()
+			if v < last {
+				t.Errorf("Value went from %v back to %v", last, v)
+			}
+			last = v
+		}
+		done <- true
+	}()
+	buf := make([]Sample, nSamples)
+	last, finished := Sample(0), 0
+	for finished < 2 {
+		select {
+		case <-done:
+			finished++
+		default:
+		}
+		p.Process(buf)
+		for i, v := range buf {
+			if v != buf[0] {
+				t.Fatalf("sample %d of a block = %v, want %v as at the block's start", i, v, buf[0])
+			}
+		}
+		if buf[0] < last {
+			t.Fatalf("block value went from %v back to %v", last, buf[0])
+		}
+		last = buf[0]
+	}
+	if last != n {
+		t.Errorf("final value %v, want %v", last, n)
+	}
+}
+
+func TestEngineFade(t *testing.T) {
+	e := NewEngine()
+	e.Input("in", Value(1))
+	out := make([]int16, nSamples*nChannels)
+	var left []int16
+	block := func() {
+		e.processAudio(nil, out, portaudio.StreamCallbackTimeInfo{}, 0)
+		for i := 0; i < len(out); i += nChannels {
+			left = append(left, out[i])
+		}
+	}
+	block()
+	full := toInt16(1)
+	if left[0] != full {
+		t.Fatalf("before stopping, output = %d, want %d", left[0], full)
+	}
+
+	// Stopping ramps the output smoothly down to silence, and reports
+	// when it is done.
+	atomic.StoreInt32(&e.stopping, 1)
+	left = left[:0]
+	const n = int(fadeTime * waveHz / time.Second)
+	for len(left) < n+nSamples {
+		block()
+	}
+	for i := 1; i < len(left); i++ {
+		if d := left[i-1] - left[i]; d < 0 || d > full/int16(n)+1 {
+			t.Fatalf("fade steps by %d at sample %d", d, i)
+		}
+	}
+	if last := left[len(left)-1]; last != 0 {
+		t.Errorf("faded output = %d, want 0", last)
+	}
+	select {
+	case <-e.faded:
+	default:
+		t.Error("fade out not reported")
+	}
+
+	// Starting again fades in from silence, as Start does.
+	atomic.StoreInt32(&e.stopping, 0)
+	left = left[:0]
+	block()
+	if left[0] > full/int16(n)+1 || left[n] != full {
+		t.Errorf("fade in starts at %d and reaches %d, want 0 and %d", left[0], left[n], full)
+	}
+}
+
+// makeWAV returns a WAV file of 16-bit PCM holding the interleaved frames.
+func makeWAV(rate, channels int, frames []int16) []byte {
+	var b bytes.Buffer
+	w := func(v interface{}) { binary.Write(&b, binary.LittleEndian, v) }
+	b.WriteString("RIFF")
+	w(uint32(36 + 2*len(frames)))
+	b.WriteString("WAVEfmt ")
+	w(uint32(16))
+	w(uint16(1))
+	w(uint16(channels))
+	w(uint32(rate))
+	w(uint32(rate * channels * 2))
+	w(uint16(channels * 2))
+	w(uint16(16))
+	b.WriteString("data")
+	w(uint32(2 * len(frames)))
+	w(frames)
+	return b.Bytes()
+}
+
+func TestReadWAV(t *testing.T) {
+	s, err := ReadWAV(bytes.NewReader(makeWAV(waveHz, 2, []int16{16384, 0, -8192, -8192})))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []Sample{0.25, -0.25}; len(s) != 2 || s[0] != want[0] || s[1] != want[1] {
+		t.Errorf("stereo WAV read as %v, want %v", s, want)
+	}
+
+	s, err = ReadWAV(bytes.NewReader(makeWAV(waveHz/2, 1, make([]int16, 100))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s) != 200 {
+		t.Errorf("WAV at half the sample rate read as %d samples, want 200", len(s))
+	}
+
+	if _, err := ReadWAV(strings.NewReader("RIFF....AIFF")); err == nil {
+		t.Error("reading a non-WAV file succeeded")
+	}
+
+	// Malformed files are read as far as they go, without panicking.
+	wav := makeWAV(waveHz, 1, []int16{16384, 16384, 16384})
+	for _, c := range []struct {
+		name string
+		b    []byte
+		want int
+	}{
+		{"data chunk cut to an odd length", wav[:len(wav)-3], 1},
+		{"odd final chunk without a pad byte", append(append([]byte{}, wav...), "LIST\x03\x00\x00\x00abc"...), 3},
+		{"final chunk cut short", append(append([]byte{}, wav...), "LIST\x09\x00\x00\x00abc"...), 3},
+	} {
+		s, err := ReadWAV(bytes.NewReader(c.b))
+		if err != nil || len(s) != c.want {
+			t.Errorf("%s: read %d samples, error %v; want %d samples", c.name, len(s), err, c.want)
+		}
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	quiet := []Sample{0.1, -0.2, 0.05, 0}
+	s := Normalize(quiet, 0.9)
+	if p := peak(s); !near(p, 0.9) || p > 0.9 {
+		t.Errorf("normalized peak = %v, want 0.9", p)
+	}
+	if !near(s[0], 0.45) || quiet[1] != -0.2 {
+		t.Errorf("normalized %v to %v", quiet, s)
+	}
+	if s := Normalize(make([]Sample, 3), 1); peak(s) != 0 {
+		t.Errorf("normalized silence to %v", s)
+	}
+
+	wav := makeWAV(waveHz, 1, []int16{1000, -2000})
+	s, err := LoadSample(bytes.NewReader(wav), 0.5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !near(s[1], -0.5) {
+		t.Errorf("loaded and normalized sample = %v, want peak of 0.5", s)
+	}
+	if s, _ := LoadSample(bytes.NewReader(wav), 0); s[1] != -2000.0/waveAmp {
+		t.Errorf("loaded without normalizing = %v", s)
+	}
+}
+
+func TestSampler(t *testing.T) {
+	p := NewSampler([]Sample{1, 2, 3})
+	p.Input("trig", &tape{s: []Sample{2: 1, 3: 0, 4: 1}})
+	s := render(p, 1)
+	if want := []Sample{0, 0, 1, 2, 1, 2, 3, 0}; !equalSamples(s[:len(want)], want) {
+		t.Errorf("sampler played %v, want %v", s[:len(want)], want)
+	}
+
+	buf := []Sample{1, 2, 3, 4, 5, 6, 7, 8}
+	for _, c := range []struct {
+		name       string
+		mode       int
+		start, end Sample
+		want       []Sample
+	}{
+		{"reverse", SampleReverse, 0, 1, []Sample{8, 7, 6, 5, 4, 3, 2, 1, 0, 0}},
+		{"region", SampleOneShot, 0.25, 0.75, []Sample{3, 4, 5, 6, 0, 0}},
+		{"reverse region", SampleReverse, 0.25, 0.75, []Sample{6, 5, 4, 3, 0, 0}},
+		{"loop", SampleLoop, 0.25, 0.75, []Sample{3, 4, 5, 6, 3, 4, 5, 6, 3}},
+		{"ping-pong", SamplePingPong, 0.25, 0.75, []Sample{3, 4, 5, 6, 5, 4, 3, 4, 5}},
+		{"between samples", SampleOneShot, 0.5 / 8, 0.5, []Sample{1.5, 2.5, 3.5, 4.5, 0}},
+	} {
+		p := NewSampler(buf)
+		p.Input("trig", &tape{s: []Sample{1}})
+		p.Input("mode", Value(c.mode))
+		p.Input("start", Value(c.start))
+		p.Input("end", Value(c.end))
+		if s := render(p, 1)[:len(c.want)]; !equalSamples(s, c.want) {
+			t.Errorf("%s: played %v, want %v", c.name, s, c.want)
+		}
+	}
+}
+
+func TestSamplerCrossfade(t *testing.T) {
+	ramp := make([]Sample, 100)
+	for i := range ramp {
+		ramp[i] = Sample(i) / 100
+	}
+	jump := func(xfade int) (max float64) {
+		p := NewSampler(ramp)
+		p.Input("trig", &tape{s: []Sample{1}})
+		p.Input("mode", Value(SampleLoop))
+		p.SetCrossfade(xfade)
+		s := render(p, 2)
+		for i := 1; i < len(s); i++ {
+			max = math.Max(max, math.Abs(float64(s[i]-s[i-1])))
+		}
+		return max
+	}
+	if d := jump(0); d < 0.9 {
+		t.Errorf("without crossfade, largest step is %v, want the seam of 0.99", d)
+	}
+	if d := jump(20); d > 0.06 {
+		t.Errorf("with crossfade, largest step is %v, want no seam", d)
+	}
+	if d := jump(-20); d < 0.9 {
+		t.Errorf("with negative crossfade, largest step is %v, want the seam of 0.99", d)
+	}
+}
+
+func TestWavetable(t *testing.T) {
+	tables := [][]Sample{{1}, {2, 2}, {4, 4, 4}}
+	for _, c := range []struct {
+		morph, want Sample
+	}{
+		{0, 1},
+		{1, 4},
+		{0.5, 2},
+		{0.25, 1.5},
+		{2, 4}, // clamped
+	} {
+		o := NewWavetable(tables)
+		o.Input("morph", Value(c.morph))
+		if v := render(o, 1)[10]; !near(v, c.want) {
+			t.Errorf("morph %v: output %v, want %v", c.morph, v, c.want)
+		}
+	}
+
+	// The phase runs through each table at the pitch.
+	o := NewWavetable([][]Sample{{0, 1, 0, -1}, {1, 0, -1, 0}})
+	o.Input("pitch", Value(HzToSample(waveHz/4)))
+	o.Input("morph", Value(0.5))
+	s := render(o, 1)
+	for i, want := range []Sample{0.5, 0.5, -0.5, -0.5, 0.5, 0.5, -0.5, -0.5} {
+		if math.Abs(float64(s[i]-want)) > 0.01 {
+			t.Errorf("sample %d = %v, want %v", i, s[i], want)
+		}
+	}
+}
+
+func TestKeyTrack(t *testing.T) {
+	pitch := make([]Sample, nSamples)
+	for i := range pitch {
+		pitch[i] = Sample(i%24)*semitone - 0.1
+	}
+	for _, amount := range []Sample{1, 0.5} {
+		k := NewKeyTrack()
+		k.Input("pitch", &tape{s: pitch})
+		k.Input("amount", Value(amount))
+		for i, v := range render(k, 1) {
+			if want := pitch[i] * amount; !near(v, want) {
+				t.Fatalf("amount %v: output %d = %v, want %v", amount, i, v, want)
+			}
+		}
+	}
+
+	// At amount 1, a filter's cutoff follows the pitch exactly.
+	k := NewKeyTrack()
+	k.Input("pitch", Value(0.1))
+	cutoff := NewSum()
+	cutoff.Input("a", Value(-0.2))
+	cutoff.Input("b", k)
+	if v := render(cutoff, 1)[0]; !near(v, -0.1) {
+		t.Errorf("cutoff = %v, want an octave up at -0.1", v)
+	}
+}
+
+func TestVelMod(t *testing.T) {
+	out := func(vel Sample) (amp, cutoff, time Sample) {
+		v := NewVelMod()
+		v.Input("vel", Value(vel))
+		v.Input("amp", Value(0.5))
+		v.Input("cutoff", Value(0.2))
+		v.Input("time", Value(0.8))
+		return render(v, 1)[0], render(v.Cutoff(), 1)[0], render(v.Time(), 1, v)[0]
+	}
+	for _, c := range []struct {
+		vel, amp, cutoff, time Sample
+	}{
+		{0, 0.5, 0, 1},
+		{0.5, 0.75, 0.1, 0.6},
+		{1, 1, 0.2, 0.2},
+	} {
+		amp, cutoff, time := out(c.vel)
+		if !near(amp, c.amp) || !near(cutoff, c.cutoff) || !near(time, c.time) {
+			t.Errorf("vel %v: amp, cutoff, time = %v, %v, %v, want %v, %v, %v",
+				c.vel, amp, cutoff, time, c.amp, c.cutoff, c.time)
+		}
+	}
+}
+
+func TestSlewModes(t *testing.T) {
+	// glideTime returns the number of samples a Slew in the given mode,
+	// with a time of 100 samples, takes to glide from 0 to a.
+	glideTime := func(mode int, a Sample) int {
+		l := NewSlew()
+		l.Input("mode", Value(mode))
+		l.Input("time", Value(100.0/waveHz))
+		in := make([]Sample, 4*nSamples)
+		for i := 1; i < len(in); i++ {
+			in[i] = a
+		}
+		l.Input("in", &tape{s: in})
+		for i, v := range render(l, 4) {
+			if math.Abs(float64(v-a)) < 1e-6 {
+				return i
+			}
+		}
+		return -1
+	}
+	for _, c := range []struct {
+		name         string
+		mode         int
+		small, large int
+	}{
+		{"fixed time", SlewTime, 100, 100},
+		{"fixed rate", SlewRate, 10, 200},
+	} {
+		if n := glideTime(c.mode, 0.01); n != c.small {
+			t.Errorf("%s: a tenth of an octave took %d samples, want %d", c.name, n, c.small)
+		}
+		if n := glideTime(c.mode, 0.2); n != c.large {
+			t.Errorf("%s: two octaves took %d samples, want %d", c.name, n, c.large)
+		}
+	}
+}
+
+func TestReset(t *testing.T) {
+	o := NewSin()
+	o.Input("pitch", Value(-0.2))
+	first := render(o, 1)
+	render(o, 3)
+	o.Reset()
+	if got := render(o, 1); !equalSamples(got, first) {
+		t.Errorf("after Reset, sin starts at %v, want %v", got[:4], first[:4])
+	}
+
+	// ResetAll clears the whole voice: the envelope, the filter and the
+	// reverb's tail as well as the oscillator.
+	e := NewEnv()
+	e.Input("gate", Value(1))
+	m := NewMul()
+	m.Input("a", o)
+	m.Input("b", e)
+	f := NewLowPass()
+	f.Input("in", m)
+	r := NewReverb()
+	r.Input("in", f)
+	o.Reset()
+	want := render(r, 4)
+	render(r, 8)
+	ResetAll(r)
+	if got := render(r, 4); !equalSamples(got, want) {
+		t.Error("voice plays differently after ResetAll")
+	}
+
+	clock := func(bpm Value) Processor {
+		c := NewClock()
+		c.Input("bpm", bpm)
+		return c
+	}
+	seq := func() *Seq {
+		return NewSeq([]Step{{Pitch: 0.1, Prob: 1}, {Pitch: 0.2, Prob: 1, Ratchet: 2}})
+	}
+	for _, c := range []struct {
+		name string
+		mk   func() Processor
+	}{
+		{"counter", func() Processor {
+			c := NewCounter()
+			c.Input("trig", clock(20000))
+			c.Input("max", Value(5))
+			return c
+		}},
+		{"counter trigger edge", func() Processor {
+			c := NewCounter()
+			c.Input("trig", Value(1))
+			return c
+		}},
+		{"song", func() Processor {
+			g := NewSong([]Part{{seq(), 1}, {seq(), 2}})
+			g.Input("clock", clock(20000))
+			return g.Pitch()
+		}},
+		{"seq pitch", func() Processor {
+			q := NewSeq([]Step{{Pitch: 0.1, Prob: 0}, {Pitch: 0.2, Prob: 1}})
+			q.Input("clock", clock(20000))
+			return q.Pitch()
+		}},
+		{"burst", func() Processor {
+			b := NewBurst()
+			b.Input("trig", clock(5000))
+			b.Input("count", Value(3))
+			b.Input("rate", Value(1000))
+			return b
+		}},
+		{"clockmul", func() Processor {
+			c := NewClockMul()
+			c.Input("clock", clock(20000))
+			c.Input("mult", Value(3))
+			return c
+		}},
+		{"decimate", func() Processor {
+			d := NewDecimate()
+			d.Input("in", Value(0.7))
+			d.Input("rate", Value(1000))
+			return d
+		}},
+		{"latch", func() Processor {
+			l := NewLatch()
+			l.Input("trig", clock(20000))
+			return l
+		}},
+		{"debounce", func() Processor {
+			d := NewDebounce()
+			d.Input("trig", clock(20000))
+			d.Input("time", Value(0.005))
+			return d
+		}},
+		{"taptempo", func() Processor {
+			tt := NewTapTempo()
+			tt.Input("tap", clock(20000))
+			return tt
+		}},
+		{"quantizetrig", func() Processor {
+			q := NewQuantizeTrig()
+			q.Input("trig", clock(7000))
+			q.Input("clock", clock(20000))
+			return q
+		}},
+		{"feedback", func() Processor {
+			f := NewFeedback()
+			m := NewMul()
+			m.Input("a", f.Return())
+			m.Input("b", Value(0.5))
+			s := NewSum()
+			s.Input("a", clock(20000))
+			s.Input("b", m)
+			f.Input("in", s)
+			return f
+		}},
+		{"resample", func() Processor {
+			r := NewResample(0.7)
+			r.Input("in", clock(20000))
+			return r
+		}},
+	} {
+		want := c.mk()
+		w := render(want, 4, Tickers(want)...)
+		p := c.mk()
+		render(p, 7, Tickers(p)...)
+		ResetAll(p)
+		if got := render(p, 4, Tickers(p)...); !equalSamples(got, w) {
+			t.Errorf("%s plays differently after ResetAll", c.name)
+		}
+	}
+
+	sw := NewSwap()
+	sw.Input("in", Value(0))
+	sw.SwapTo(Value(1))
+	sw.Reset()
+	if v := render(sw, 1)[0]; v != 1 {
+		t.Errorf("swap after Reset = %v, want the new source, 1", v)
+	}
+}
+
+func TestTriggerPolarity(t *testing.T) {
+	sig := []Sample{1, 1, 0, 0, 1, 0.8, 0.2, 1, -1}
+	var tr Trigger
+	tr.SetPolarity(TriggerFalling)
+	var got []int
+	for i, v := range sig {
+		if tr.Next(v) {
+			got = append(got, i)
+		}
+	}
+	if want := []int{2, 6, 8}; !equalInts(got, want) {
+		t.Errorf("falling edges at %v, want %v", got, want)
+	}
+
+	// An inverted gate with a threshold of 0 drives an Env.
+	e := NewEnv()
+	if err := SetTrigger(e, "trig", 0, TriggerFalling); err != nil {
+		t.Fatal(err)
+	}
+	e.Input("trig", &tape{s: []Sample{1, 1, 1, -1, -1, 1}})
+	e.Input("att", Value(0))
+	if s := render(e, 1); s[2] != 0 || s[3] != 1 {
+		t.Errorf("env = %v, want an attack at sample 3", s[:5])
+	}
+	if err := SetTrigger(e, "att", 0, TriggerFalling); err == nil {
+		t.Error("SetTrigger on a non-trigger input succeeded")
+	}
+}
+
+func TestSumN(t *testing.T) {
+	for _, n := range []int{1, 2, 8} {
+		got, want := render(sumN(n), 1), render(sumChain(n), 1)
+		if !equalSamples(got, want) {
+			t.Errorf("SumN(%d) = %v..., want %v...", n, got[:2], want[:2])
+		}
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Errorf("NewSumN(0) did not panic")
+		}
+	}()
+	NewSumN(0)
+}
+
+func TestMonitor(t *testing.T) {
+	newPatch := func() Processor {
+		o := NewSin()
+		o.Input("pitch", modulation())
+		return o
+	}
+	want := render(newPatch(), 4)
+
+	e := NewEngine()
+	e.Input("in", newPatch())
+	var l, r []Sample
+	e.SetMonitor(func(bl, br []Sample) {
+		l = append(l, bl...)
+		r = append(r, br...)
+	})
+	out := make([]int16, nSamples*nChannels)
+	for i := 0; i < 2; i++ {
+		e.processAudio(nil, out, portaudio.StreamCallbackTimeInfo{}, 0)
+	}
+	if err := e.Render(ioutil.Discard, 2, Format{}); err != nil {
+		t.Fatal(err)
+	}
+	e.SetMonitor(nil)
+	if !equalSamples(l, want) || !equalSamples(r, want) {
+		t.Errorf("monitor got %d and %d samples differing from the output's %d", len(l), len(r), len(want))
+	}
+
+	// Offline rendering waits for a slow monitor rather than dropping blocks.
+	n := 0
+	e.SetMonitor(func(bl, br []Sample) {
+		time.Sleep(100 * time.Microsecond)
+		n++
+	})
+	if err := e.Render(ioutil.Discard, 4*monitorBlocks, Format{}); err != nil {
+		t.Fatal(err)
+	}
+	e.SetMonitor(nil)
+	if n != 4*monitorBlocks {
+		t.Errorf("slow monitor got %d blocks of %d", n, 4*monitorBlocks)
+	}
+}
+
+func TestCab(t *testing.T) {
+	for _, ir := range [][]Sample{CabClosed, CabOpen} {
+		in := NewImpulse()
+		in.Input("trig", Value(1))
+		c := NewCabIR(ir)
+		c.Input("in", in)
+		out := render(c, 4)
+
+		// The response to an impulse is the IR, and so has its spectrum.
+		spectrum := func(s []Sample) []float64 {
+			x := make([]complex128, 1024)
+			for i := range s {
+				x[i] = complex(float64(s[i]), 0)
+			}
+			dsp.FFT(x)
+			m := make([]float64, len(x)/2)
+			for i := range m {
+				m[i] = cmplx.Abs(x[i])
+			}
+			return m
+		}
+		got, want := spectrum(out[:len(ir)]), spectrum(ir)
+		for i := range got {
+			if math.Abs(got[i]-want[i]) > 1e-4 {
+				t.Fatalf("bin %d = %v, want %v", i, got[i], want[i])
+			}
+		}
+		if p := peak(out[len(ir):]); p != 0 {
+			t.Errorf("output after the IR peaks at %v, want 0", p)
+		}
+	}
+
+	// NewCab reads the IR from a WAV file.
+	dir, err := ioutil.TempDir("", "cab")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "ir.wav")
+	if err := ioutil.WriteFile(path, makeWAV(waveHz, 1, []int16{16384, 8192}), 0666); err != nil {
+		t.Fatal(err)
+	}
+	c, err := NewCab(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Input("in", Value(1))
+	if s := render(c, 1); math.Abs(float64(s[0]-0.5)) > 1e-3 || math.Abs(float64(s[1]-0.75)) > 1e-3 {
+		t.Errorf("step response = %v, want [0.5 0.75 ...]", s[:2])
+	}
+	if _, err := NewCab(filepath.Join(dir, "missing.wav")); err == nil {
+		t.Error("NewCab of a missing file succeeded")
+	}
+}
+
+func TestBlockSize(t *testing.T) {
+	o := NewSin()
+	for _, n := range []int{0, BlockSize - 1, BlockSize + 1} {
+		if err := ProcessBlock(o, make([]Sample, n)); err == nil {
+			t.Errorf("ProcessBlock of %d samples succeeded", n)
+		}
+	}
+	s := make([]Sample, BlockSize)
+	if err := ProcessBlock(o, s); err != nil {
+		t.Fatal(err)
+	}
+	if want := render(NewSin(), 1); !equalSamples(s, want) {
+		t.Errorf("ProcessBlock rendered %v..., want %v...", s[:4], want[:4])
+	}
+
+	// A Dup output would otherwise copy a partial block.
+	defer func() {
+		if err, ok := recover().(error); !ok || !strings.Contains(err.Error(), "BlockSize") {
+			t.Errorf("short Dup output panicked with %v, want a block size error", err)
+		}
+	}()
+	NewDup(NewSin()).Output().Process(make([]Sample, BlockSize/2))
+}
+
+func TestAdditive(t *testing.T) {
+	const hz = 1000
+	for _, c := range []struct {
+		hz       float64
+		stretch  Sample
+		harmonic bool
+	}{
+		{hz, 0, true},
+		{hz, 0.05, false},
+		{hz, -0.05, false},
+		{10000, 0, true}, // only two partials are below Nyquist
+	} {
+		o := NewAdditive()
+		o.Input("pitch", Value(HzToSample(c.hz)))
+		o.Input("stretch", Value(c.stretch))
+		s := render(o, 32)
+		off := aliasing(s, c.hz)
+		if c.harmonic && off > 1e-3 || !c.harmonic && off < 0.1 {
+			t.Errorf("%vHz, stretch %v: %.4f of the power is off the harmonic series", c.hz, c.stretch, off)
+		}
+		if p := peak(s); p > 1 {
+			t.Errorf("%vHz, stretch %v: peak %v, want at most 1", c.hz, c.stretch, p)
+		}
+	}
+}
+
+// TestAllocs checks that rendering a block through each module allocates
+// nothing, so that the audio thread never waits on the garbage collector.
+func TestAllocs(t *testing.T) {
+	sample := make([]Sample, 1000)
+	for i := range sample {
+		sample[i] = Sample(i%100) / 100
+	}
+	mm := NewModMatrix()
+	mmDst := NewLowPass()
+	mm.Route(NewLFO(), mmDst, "cutoff", 0.1)
+	seq := func() *Seq {
+		return NewSeq([]Step{{Prob: 1, Ratchet: 2}, {Pitch: 0.1, Prob: 1, Tie: true}, {Prob: 0.5}})
+	}
+	square, saw := NewSquare(), NewSaw()
+	square.SetOversample(4)
+	saw.SetOversample(4)
+	mods := map[string]Processor{
+		"abs":         NewAbs(),
+		"additive":    NewAdditive(),
+		"aftertouch":  NewAftertouch(),
+		"analyzer":    NewAnalyzer(1024),
+		"atten":       NewAtten(),
+		"autopan":     NewAutoPan(),
+		"burst":       NewBurst(),
+		"cab":         NewCabIR(CabOpen),
+		"chord":       NewChord(),
+		"clip":        NewClip(),
+		"clock":       NewClock(),
+		"clockmul":    NewClockMul(),
+		"counter":     NewCounter(),
+		"debounce":    NewDebounce(),
+		"decimate":    NewDecimate(),
+		"dup":         NewDup(NewSin()).Output(),
+		"env":         NewEnv(),
+		"expander":    NewExpander(),
+		"feedback":    NewFeedback(),
+		"finetune":    NewFineTune(),
+		"gain":        NewGain(),
+		"graphiceq":   NewGraphicEQ(10),
+		"haas":        NewHaas(),
+		"highshelf":   NewHighShelf(),
+		"impulse":     NewImpulse(),
+		"invert":      NewInvert(),
+		"keytrack":    NewKeyTrack(),
+		"latch":       NewLatch(),
+		"lfo":         NewLFO(),
+		"lowpass":     NewLowPass(),
+		"lowshelf":    NewLowShelf(),
+		"midigate":    NewMidiGate(),
+		"midinote":    NewMidiNote(),
+		"midivel":     NewMidiVelocity(),
+		"modmatrix":   mmDst,
+		"modwheel":    NewModWheel(),
+		"mul":         NewMul(),
+		"multiband":   NewMultiband([]float64{200, 2000}).Band(1),
+		"mux":         NewMux(3),
+		"oversample":  NewOversample(4, NewSoftClip()),
+		"param":       NewParam(0.5),
+		"pingpong":    NewPingPong(),
+		"pitchbend":   NewPitchBend(),
+		"quantize":    NewQuantizeTrig(),
+		"rand":        NewRand(),
+		"rectify":     NewRectify(RectifyNegative),
+		"resample":    NewResample(1.5),
+		"reverb":      NewReverb(),
+		"sampler":     NewSampler(sample),
+		"saw":         NewSaw(),
+		"saw x4":      saw,
+		"seq":         seq(),
+		"shnoise":     NewSHNoise(),
+		"sin":         NewSin(),
+		"slew":        NewSlew(),
+		"softclip":    NewSoftClip(),
+		"song":        NewSong([]Part{{seq(), 1}, {seq(), 2}}),
+		"split":       NewSplit(NewWidth()),
+		"square":      NewSquare(),
+		"square x4":   square,
+		"stereo":      NewStereo(),
+		"stereodelay": NewStereoDelay(),
+		"sum":         NewSum(),
+		"sumn":        NewSumN(4),
+		"swap":        NewSwap(),
+		"taptempo":    NewTapTempo(),
+		"transient":   NewTransient(),
+		"tremolo":     NewTremolo(),
+		"unitstep":    NewUnitStep(),
+		"vca":         NewVCA(VCALinear),
+		"velmod":      NewVelMod(),
+		"velocity":    NewVelocity(),
+		"vibrato":     NewVibrato(),
+		"walk":        NewWalk(),
+		"wavetable":   NewWavetable([][]Sample{sample[:100], sample[:50]}),
+		"wetdry":      NewWetDry(NewReverb()),
+		"z1":          NewZ1(),
+	}
+	buf := make([]Sample, nSamples)
+	for name, p := range mods {
+		if s, ok := p.(Sink); ok {
+			for _, in := range s.Inputs() {
+				switch {
+				case IsTriggerInput(s, in):
+					s.Input(in, &pulses{n: 100})
+				case in == "in" || in == "a" || in == "in0":
+					s.Input(in, modulation())
+				}
+			}
+		}
+		ts := Tickers(p)
+		if name == "modmatrix" {
+			ts = append(ts, mm)
+		}
+		block := func() {
+			p.Process(buf)
+			for _, t := range ts {
+				t.Tick()
+			}
+		}
+		// Modules allocate their buffers when they are made, so even the
+		// first block mustn't allocate.
+		if n := mallocs(1, block); n != 0 {
+			t.Errorf("%s: %d allocations in the first block, want 0", name, n)
+		}
+		for i := 0; i < 100; i++ { // let the module settle
+			block()
+		}
+		if n := mallocs(1000, block); n != 0 {
+			t.Errorf("%s: %d allocations in 1000 blocks, want 0", name, n)
+		}
+	}
+
+	e := NewEngine()
+	e.Input("in", NewReverb())
+	out := make([]int16, nSamples*nChannels)
+	block := func() {
+		e.processAudio(nil, out, portaudio.StreamCallbackTimeInfo{}, 0)
+	}
+	for i := 0; i < 100; i++ {
+		block()
+	}
+	// No monitor is set, as mallocs would count the allocations the
+	// runtime makes for its goroutine, which is not the audio thread.
+	if n := mallocs(1000, block); n != 0 {
+		t.Errorf("engine: %d allocations in 1000 blocks, want 0", n)
+	}
+}
+
+// mallocs returns the number of heap allocations made while calling f n
+// times. Unlike testing.AllocsPerRun, which rounds down the average, it
+// counts allocations that f makes only now and then.
+func mallocs(n int, f func()) uint64 {
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	for i := 0; i < n; i++ {
+		f()
+	}
+	runtime.ReadMemStats(&after)
+	return after.Mallocs - before.Mallocs
+}
+
+func TestExportDOT(t *testing.T) {
+	lfo := NewLFO()
+	d := NewDup(lfo)
+	o := NewSin()
+	o.Input("pitch", d.Output())
+	c := NewChord()
+	m := NewMul()
+	m.Input("a", c.Note(1))
+	m.Input("b", d.Output())
+	s := NewSum()
+	s.Input("a", o)
+	s.Input("b", m)
+	got := ExportDOT(s)
+	if !strings.HasPrefix(got, "digraph patch {\n") || !strings.HasSuffix(got, "}\n") {
+		t.Errorf("DOT is not a digraph:\n%s", got)
+	}
+	for _, want := range []string{
+		`n0 [label="Sum"];`,
+		`n1 [label="Sin"];`,
+		`n2 [label="Dup"];`,
+		`n3 [label="LFO"];`,
+		`n3 -> n2;`,
+		`n2 -> n1 [label="pitch"];`,
+		`n1 -> n0 [label="a"];`,
+		`n6 [label="Mul"];`,
+		`n7 [label="Chord"];`,
+		`n7 -> n6 [label="a (output 1)"];`,
+		`n2 -> n6 [label="b"];`,
+		`n6 -> n0 [label="b"];`,
+	} {
+		if !strings.Contains(got, "\t"+want+"\n") {
+			t.Errorf("DOT lacks %s:\n%s", want, got)
+		}
+	}
+	if n := strings.Count(got, `[label="Dup"]`); n != 1 {
+		t.Errorf("DOT has %d Dup nodes, want 1", n)
+	}
+
+	// Trigger outputs are numbered too.
+	q := NewSeq([]Step{{Prob: 1}})
+	e := NewEnv()
+	e.Input("trig", q.EOC())
+	got = ExportDOT(e)
+	if want := `n2 -> n0 [label="trig (output 2)"];`; !strings.Contains(got, "\t"+want+"\n") {
+		t.Errorf("DOT lacks %s:\n%s", want, got)
+	}
+}
@@ -0,0 +1,124 @@
+/*
+Copyright 2026 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package audio
+
+import (
+	"math/cmplx"
+
+	"github.com/nf/sigourney/dsp"
+)
+
+// NewAnalyzer returns a spectrum analyzer that passes its "in" input
+// through unchanged. It collects the input in frames of size samples,
+// which must be a power of two no less than 2, for Spectrum to transform.
+// Frames are handed from the audio thread to the reader without blocking
+// either; if the reader falls behind, frames are dropped.
+func NewAnalyzer(size int) *Analyzer {
+	if size < 2 || size&(size-1) != 0 {
+		panic("analyzer size is not a power of two of at least 2")
+	}
+	a := &Analyzer{
+		free:  make(chan []Sample, 2),
+		ready: make(chan []Sample, 1),
+		win:   make([]float64, size),
+		fft:   make([]complex128, size),
+		spec:  make([]float64, size/2+1),
+	}
+	for i := 0; i < 2; i++ {
+		a.free <- make([]Sample, 0, size)
+	}
+	var sum float64
+	for i := range a.win {
+		a.win[i] = hann(2*float64(i)/float64(size) - 1)
+		sum += a.win[i]
+	}
+	a.norm = 2 / sum
+	a.inputs("in", &a.in)
+	return a
+}
+
+type Analyzer struct {
+	sink
+	in Processor
+
+	cur         []Sample      // frame being filled by the audio thread
+	free, ready chan []Sample // frames to fill, and filled frames
+
+	win  []float64
+	norm float64 // scale of the magnitudes such that a sine of amplitude 1 has a peak of 1
+	fft  []complex128
+	spec []float64
+}
+
+func (a *Analyzer) Process(s []Sample) {
+	a.in.Process(s)
+	for len(s) > 0 {
+		if a.cur == nil {
+			select {
+			case a.cur = <-a.free:
+			default:
+				return
+			}
+		}
+		n := cap(a.cur) - len(a.cur)
+		if n > len(s) {
+			n = len(s)
+		}
+		a.cur = append(a.cur, s[:n]...)
+		s = s[n:]
+		if len(a.cur) == cap(a.cur) {
+			select {
+			case a.ready <- a.cur:
+				a.cur = nil
+			default:
+				a.cur = a.cur[:0]
+			}
+		}
+	}
+}
+
+// Reset discards the partly collected frame.
+func (a *Analyzer) Reset() {
+	if a.cur != nil {
+		a.cur = a.cur[:0]
+	}
+}
+
+// Spectrum returns the magnitude spectrum of the most recent frame, with
+// size/2+1 bins spaced evenly from 0Hz to the Nyquist frequency. A sine of
+// amplitude 1 centred on a bin has a magnitude of 1 there. The result is
+// only valid until the next call, which must not be concurrent.
+func (a *Analyzer) Spectrum() []float64 {
+	select {
+	case f := <-a.ready:
+		for i, v := range f {
+			a.fft[i] = complex(float64(v)*a.win[i], 0)
+		}
+		a.free <- f[:0]
+		dsp.FFT(a.fft)
+		for i := range a.spec {
+			a.spec[i] = cmplx.Abs(a.fft[i]) * a.norm
+		}
+	default:
+	}
+	return a.spec
+}
+
+// BinHz returns the frequency at the centre of bin i of the Spectrum.
+func (a *Analyzer) BinHz(i int) float64 {
+	return float64(i) * waveHz / float64(len(a.fft))
+}
@@ -0,0 +1,115 @@
+/*
+Copyright 2026 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package audio
+
+import (
+	"fmt"
+	"sort"
+)
+
+// An AutomationEvent sets an input of a module to a value at a time.
+type AutomationEvent struct {
+	Time  float64 // seconds from the start of rendering
+	Input string  // name of the input
+	Value Sample
+
+	// Ramp makes the input move in a straight line to Value from the
+	// event before, rather than stepping to it at Time.
+	Ramp bool
+}
+
+// Automate connects each input of s named by the events to a Processor
+// that plays the events for that input, sample-accurately, for offline
+// rendering with Engine.Render. Times are measured from the first block the
+// automation renders, so Automate should be called just before rendering.
+// Before its first event an input keeps its value, if it is a Value or a
+// Param, or else takes 0.
+func Automate(s Sink, events []AutomationEvent) error {
+	known := make(map[string]bool)
+	for _, name := range s.Inputs() {
+		known[name] = true
+	}
+	lanes := make(map[string]*lane)
+	var names []string
+	for _, e := range events {
+		if !known[e.Input] {
+			return fmt.Errorf("automation of unknown input %q", e.Input)
+		}
+		l, ok := lanes[e.Input]
+		if !ok {
+			l = &lane{}
+			if in, ok := s.(inputter); ok {
+				switch v := in.input(e.Input).(type) {
+				case Value:
+					l.v = Sample(v)
+				case *Param:
+					l.v = v.Value()
+				}
+			}
+			l.from = l.v
+			lanes[e.Input] = l
+			names = append(names, e.Input)
+		}
+		l.events = append(l.events, e)
+	}
+	for _, name := range names {
+		l := lanes[name]
+		sort.Stable(byTime(l.events))
+		s.Input(name, l)
+	}
+	return nil
+}
+
+type byTime []AutomationEvent
+
+func (e byTime) Len() int           { return len(e) }
+func (e byTime) Less(i, j int) bool { return e[i].Time < e[j].Time }
+func (e byTime) Swap(i, j int)      { e[i], e[j] = e[j], e[i] }
+
+// lane plays the automation events for one input.
+type lane struct {
+	events []AutomationEvent
+	next   int // index of the next event
+	t      int // samples rendered
+
+	v        Sample // value set by the last event
+	from     Sample // value at the last event, for ramps
+	fromTime int    // sample position of the last event
+}
+
+// at returns the sample position of the event e.
+func at(e AutomationEvent) int {
+	return int(e.Time*waveHz + 0.5)
+}
+
+func (l *lane) Process(s []Sample) {
+	for i := range s {
+		for l.next < len(l.events) && at(l.events[l.next]) <= l.t {
+			e := l.events[l.next]
+			l.v, l.from, l.fromTime = e.Value, e.Value, at(e)
+			l.next++
+		}
+		s[i] = l.v
+		if l.next < len(l.events) {
+			if e := l.events[l.next]; e.Ramp {
+				f := Sample(l.t-l.fromTime) / Sample(at(e)-l.fromTime)
+				s[i] = l.from + (e.Value-l.from)*f
+			}
+		}
+		l.t++
+	}
+}
@@ -0,0 +1,34 @@
+/*
+Copyright 2026 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package audio
+
+// BenchProcess renders the given number of blocks from p, ticking the
+// Tickers in its graph after each block as the Engine would, and discards
+// the output. It is intended for measuring the cost of a module from a
+// benchmark. It walks the graph and allocates its buffer once, before the
+// first block, so a benchmark should render all its blocks with one call,
+// as in BenchProcess(p, b.N).
+func BenchProcess(p Processor, blocks int) {
+	ts := Tickers(p)
+	buf := make([]Sample, nSamples)
+	for i := 0; i < blocks; i++ {
+		p.Process(buf)
+		for _, t := range ts {
+			t.Tick()
+		}
+	}
+}
@@ -0,0 +1,126 @@
+/*
+Copyright 2026 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package audio
+
+import (
+	"math"
+	"os"
+)
+
+// NewCab returns a cabinet simulation that convolves its "in" input with
+// the impulse response of a guitar speaker cabinet, read from the WAV file
+// at irPath. It follows a waveshaper or distortion to turn its harsh
+// output into a convincing amp tone.
+func NewCab(irPath string) (*Cab, error) {
+	f, err := os.Open(irPath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	ir, err := ReadWAV(f)
+	if err != nil {
+		return nil, err
+	}
+	return NewCabIR(ir), nil
+}
+
+// NewCabIR returns a cabinet simulation with the given impulse response,
+// such as CabClosed or CabOpen. The convolution is computed directly, which
+// suits the short responses of speaker cabinets, of tens of milliseconds;
+// responses longer than cabMaxIR are truncated.
+func NewCabIR(ir []Sample) *Cab {
+	if len(ir) > cabMaxIR {
+		ir = ir[:cabMaxIR]
+	}
+	c := &Cab{ir: append([]Sample(nil), ir...)}
+	c.hist = make([]Sample, 2*len(ir))
+	c.inputs("in", &c.in)
+	return c
+}
+
+// cabMaxIR is the longest impulse response used by a Cab, about 46ms.
+const cabMaxIR = 2048
+
+type Cab struct {
+	sink
+	in Processor
+
+	ir []Sample
+	// hist holds the recent input twice over, newest first from pos,
+	// so that the last len(ir) samples are always contiguous.
+	hist []Sample
+	pos  int
+}
+
+func (c *Cab) Process(s []Sample) {
+	c.in.Process(s)
+	n := len(c.ir)
+	if n == 0 {
+		return
+	}
+	for i, x := range s {
+		if c.pos--; c.pos < 0 {
+			c.pos = n - 1
+		}
+		c.hist[c.pos], c.hist[c.pos+n] = x, x
+		var y Sample
+		for k, h := range c.hist[c.pos : c.pos+n] {
+			y += c.ir[k] * h
+		}
+		s[i] = y
+	}
+}
+
+// Reset clears the cabinet's memory of its input.
+func (c *Cab) Reset() {
+	for i := range c.hist {
+		c.hist[i] = 0
+	}
+	c.pos = 0
+}
+
+// Built-in impulse responses for NewCabIR, modeled on common cabinets:
+// CabClosed is a tight closed-back 4x12 with a strong low end, and CabOpen
+// an open-back 1x12 with less bass and more presence.
+var (
+	CabClosed = cabIR(90, 100, 4, 3800, 1.1)
+	CabOpen   = cabIR(120, 2500, 3, 5500, 0.8)
+)
+
+// cabIR returns the impulse response of a speaker modeled as a chain of
+// filters: a high-pass at low hz for the cabinet's bass roll-off, a peak
+// of boost decibels at peak hz, and a resonant low-pass at high hz for
+// the speaker's treble roll-off. The response is faded out over its last
+// samples, so that truncating it doesn't click.
+func cabIR(low, peak, boost, high, res float64) []Sample {
+	const n, fade = 512, 64
+	var hp, pk, lp biquad
+	hp.highpass(low, butterworthQ)
+	pk.peaking(peak, 1, boost)
+	lp.lowpass(high, res)
+	ir := make([]Sample, n)
+	x := 1.0
+	for i := range ir {
+		y := lp.next(pk.next(hp.next(x)))
+		if i >= n-fade {
+			y *= 0.5 + 0.5*math.Cos(math.Pi*float64(i-(n-fade))/fade)
+		}
+		ir[i] = Sample(y)
+		x = 0
+	}
+	return ir
+}
@@ -16,11 +16,17 @@ limitations under the License.
 
 package audio
 
-import "sort"
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"time"
+)
 
 const (
-	nChannels = 1
-	nSamples  = 256 * nChannels
+	nChannels = 2   // channels of audio output
+	nSamples  = 256 // samples per channel in each block
 )
 
 const (
@@ -30,21 +36,92 @@ const (
 
 type Sample float64
 
+// AsInt returns the integer nearest to s, for reading discrete signals
+// such as counts and note numbers.
+func AsInt(s Sample) int {
+	return int(math.Floor(float64(s) + 0.5))
+}
+
+// now is the time base used by the package. Tests may replace it.
+var now = time.Now
+
+// newRNG returns a random number generator seeded from the time, for
+// modules that draw random numbers. Such modules provide a Seed method,
+// which Engine.Seed uses to make them deterministic.
+func newRNG() *rand.Rand {
+	return rand.New(rand.NewSource(now().UnixNano()))
+}
+
+// seeder is implemented by modules that draw random numbers.
+type seeder interface {
+	Seed(seed int64)
+}
+
+// BlockSize is the number of samples in a block. The buffer passed to a
+// Processor must be exactly this long.
+const BlockSize = nSamples
+
+// A Processor renders its output a block at a time. Process fills s, which
+// must hold exactly BlockSize samples, the size of the buffers into which
+// the modules of this package read their inputs. A buffer of another size
+// is a programming error: it makes a module panic, or, if not detected,
+// corrupts the block. ProcessBlock checks the size first, for buffers from
+// outside the package.
+//
+// Process runs on the audio thread, so it must not allocate, lest it wait
+// on the garbage collector: modules allocate their buffers when they are
+// made.
 type Processor interface {
-	Process([]Sample)
+	Process(s []Sample)
+}
+
+// ProcessBlock renders a block from p into s, returning an error rather
+// than processing it if s is not BlockSize samples long.
+func ProcessBlock(p Processor, s []Sample) error {
+	if err := checkBlock(s); err != nil {
+		return err
+	}
+	p.Process(s)
+	return nil
+}
+
+// checkBlock returns an error if s is not the size of a block.
+func checkBlock(s []Sample) error {
+	if len(s) != nSamples {
+		return fmt.Errorf("audio: buffer of %d samples passed to Process, want BlockSize (%d)", len(s), nSamples)
+	}
+	return nil
 }
 
 type Ticker interface {
 	Tick()
 }
 
+// A Resetter is a module with internal state, such as the phase of an
+// oscillator, the level of an envelope or the contents of a delay. Reset
+// returns that state to how it was when the module was made, so that the
+// module may be reused, as for a new voice. Random number generators are
+// the exception: they carry on, unless reseeded with Seed.
+//
+// Every module of this package with such state is a Resetter, including
+// the MIDI modules that smooth or track the controller, such as MidiNote.
+// The controller's own state, such as the note held, is not reset.
+type Resetter interface {
+	Reset()
+}
+
+// A Sink is a module with named inputs. Each input has a default value,
+// usually Value(0), that it takes until it is connected.
 type Sink interface {
-	Input(name string, g Processor)
+	// Input connects an input to p, or restores the input's
+	// default if p is nil.
+	Input(name string, p Processor)
 	Inputs() []string
 }
 
 type sink struct {
-	m map[string]interface{}
+	m   map[string]interface{}
+	def map[string]Value
 }
 
 func (s *sink) inputs(args ...interface{}) {
@@ -58,6 +135,12 @@ func (s *sink) inputs(args ...interface{}) {
 			panic("invalid args; expected string")
 		}
 		i++
+		switch v := args[i].(type) {
+		case *Source:
+			args[i] = &v.source
+		case *TriggerSource:
+			args[i] = &v.trigger
+		}
 		s.m[name] = args[i]
 
 		switch v := args[i].(type) {
@@ -69,10 +152,26 @@ func (s *sink) inputs(args ...interface{}) {
 		case *trigger:
 			(*v).p = Value(0)
 			(*v).b = make([]Sample, nSamples)
+		case *stereoSource:
+			(*v).p = Value(0)
+			(*v).l = make([]Sample, nSamples)
+			(*v).r = make([]Sample, nSamples)
+		default:
+			panic("bad input type")
 		}
 	}
 }
 
+// setDefault sets the named input to v, and makes v the value it takes
+// when disconnected.
+func (s *sink) setDefault(name string, v Value) {
+	if s.def == nil {
+		s.def = make(map[string]Value)
+	}
+	s.def[name] = v
+	s.Input(name, v)
+}
+
 func (s *sink) Input(name string, p Processor) {
 	if s.m == nil {
 		panic("no inputs registered")
@@ -81,6 +180,9 @@ func (s *sink) Input(name string, p Processor) {
 	if !ok {
 		panic("bad input name: " + name)
 	}
+	if p == nil {
+		p = s.def[name]
+	}
 	switch v := i.(type) {
 	case *Processor:
 		*v = p
@@ -88,6 +190,8 @@ func (s *sink) Input(name string, p Processor) {
 		(*v).p = p
 	case *trigger:
 		(*v).p = p
+	case *stereoSource:
+		v.set(p)
 	default:
 		panic("bad input type")
 	}
@@ -107,22 +211,288 @@ type source struct {
 	b []Sample
 }
 
+// Module provides named inputs to modules defined outside this package,
+// which embed it to implement Sink:
+//
+//	type Filter struct {
+//		audio.Module
+//		in     audio.Processor
+//		cutoff audio.Source
+//	}
+//
+//	func NewFilter() *Filter {
+//		f := &Filter{}
+//		f.Register("in", &f.in, "cutoff", &f.cutoff)
+//		return f
+//	}
+//
+// Such modules take part in CheckTrigger, WalkGraph and the other
+// functions that inspect a patch like the modules of this package do.
+type Module struct {
+	sink
+}
+
+// Register registers the module's inputs, given as pairs of a name and a
+// pointer to the field that holds the input. The field may be a
+// Processor, which the module processes into its own output buffer, a
+// Source, or a TriggerSource. Each input is initially Value(0).
+func (m *Module) Register(args ...interface{}) {
+	m.inputs(args...)
+}
+
+// SetDefault sets the named input to v, and makes v the value it takes
+// when disconnected.
+func (m *Module) SetDefault(name string, v Value) {
+	m.setDefault(name, v)
+}
+
+// Source is an input of a Module that renders into a buffer of its own,
+// for modules that read several inputs at once. The samples returned by
+// its Process method must not be modified.
+type Source struct {
+	source
+}
+
+// TriggerSource is a Source for trigger signals, which detects triggers in
+// the rendered signal with its Next method.
+type TriggerSource struct {
+	trigger
+}
+
+// Process renders the input and returns its samples, which must not be
+// modified. An input connected to a Dup returns the Dup's buffer itself,
+// saving a copy.
 func (s *source) Process() []Sample {
+	if o, ok := s.p.(*Output); ok {
+		return o.shared()
+	}
 	s.p.Process(s.b)
 	return s.b
 }
 
-const triggerThreshold = 0.5
+// Triggers are ordinary signals that mark events: a trigger output is 0
+// except for a single sample of 1 at each event. A trigger input fires on
+// each sample that rises above TriggerThreshold from at or below it, so a
+// gate held high fires it once, when the gate opens.
+const TriggerThreshold = 0.5
+
+// Trigger detects the events in a trigger signal, for modules with
+// trigger inputs. Its zero value is ready to use: it fires as the signal
+// rises above TriggerThreshold, and treats the signal before the first
+// sample as low. SetThreshold and SetPolarity adapt it to signals with
+// other conventions, such as inverted gates.
+type Trigger struct {
+	active bool // whether the last sample was past the threshold
+
+	threshold Sample
+	custom    bool // whether threshold is set
+	falling   bool
+}
+
+// Polarities of a Trigger.
+const (
+	TriggerRising  = iota // fire as the signal rises above the threshold
+	TriggerFalling        // fire as the signal falls to or below it
+)
+
+// SetThreshold sets the level the signal must cross for the trigger to
+// fire, in place of TriggerThreshold.
+func (t *Trigger) SetThreshold(v Sample) {
+	t.threshold, t.custom = v, true
+}
+
+// SetPolarity sets whether the trigger fires on rising edges, the default,
+// or falling ones. With TriggerFalling the signal before the first sample
+// is treated as high.
+func (t *Trigger) SetPolarity(p int) {
+	t.falling = p == TriggerFalling
+}
+
+// Next reports whether the trigger fires at s, the next sample of the
+// signal: by default, whether s is above TriggerThreshold and the sample
+// before it was not.
+func (t *Trigger) Next(s Sample) bool {
+	th := Sample(TriggerThreshold)
+	if t.custom {
+		th = t.threshold
+	}
+	active := s > th
+	if t.falling {
+		active = s <= th
+	}
+	fire := !t.active && active
+	t.active = active
+	return fire
+}
 
 type trigger struct {
 	source
-	last bool
+	Trigger
 }
 
 func (t *trigger) isTrigger(s Sample) bool {
-	high := s > triggerThreshold
-	trig := !t.last && high
-	t.last = high
-	return trig
+	return t.Next(s)
+}
+
+// triggerer is implemented by modules whose output is a trigger.
+type triggerer interface {
+	triggers()
+}
+
+// triggerOutput marks an output of a module as a trigger.
+type triggerOutput struct {
+	Processor
+}
+
+func (triggerOutput) triggers() {}
+
+func (t triggerOutput) node() Processor { return t.Processor }
+
+// IsTriggerOutput reports whether p produces a trigger signal.
+func IsTriggerOutput(p Processor) bool {
+	for {
+		if _, ok := p.(triggerer); ok {
+			return true
+		}
+		o, ok := p.(*Output)
+		if !ok {
+			return false
+		}
+		p = o.d.src
+	}
+}
+
+// IsTriggerInput reports whether the named input of s expects a trigger.
+func IsTriggerInput(s Sink, name string) bool {
+	t, ok := s.(interface {
+		triggerInput(name string) bool
+	})
+	return ok && t.triggerInput(name)
+}
+
+func (s *sink) triggerInput(name string) bool {
+	_, ok := s.m[name].(*trigger)
+	return ok
+}
+
+// SetTrigger sets the threshold and polarity, TriggerRising or
+// TriggerFalling, of the named trigger input of s, so that it may be
+// driven by signals with other conventions than those of this package,
+// such as the low-going pulses of some external gear.
+func SetTrigger(s Sink, name string, threshold Sample, polarity int) error {
+	t, ok := s.(interface {
+		triggerIn(name string) *Trigger
+	})
+	var tr *Trigger
+	if ok {
+		tr = t.triggerIn(name)
+	}
+	if tr == nil {
+		return fmt.Errorf("%q is not a trigger input", name)
+	}
+	tr.SetThreshold(threshold)
+	tr.SetPolarity(polarity)
+	return nil
+}
+
+// resetTriggers makes the trigger inputs forget the last sample they saw,
+// so that a signal already high when they are next processed fires them.
+func (s *sink) resetTriggers() {
+	for _, v := range s.m {
+		if t, ok := v.(*trigger); ok {
+			t.active = false
+		}
+	}
+}
+
+// triggerIn returns the Trigger of the named trigger input, or nil.
+func (s *sink) triggerIn(name string) *Trigger {
+	if t, ok := s.m[name].(*trigger); ok {
+		return &t.Trigger
+	}
+	return nil
+}
+
+// CheckTrigger returns an error if connecting p to the named input of s
+// would feed a trigger to an input that does not expect one, such as a
+// Clock to the "a" input of a Mul. Such connections are allowed, and are
+// sometimes intended, but are more often mistakes. Any signal may drive a
+// trigger input, since gates, oscillators and the like fire it on each
+// rising edge, so those connections are not reported.
+func CheckTrigger(s Sink, name string, p Processor) error {
+	if IsTriggerOutput(p) && !IsTriggerInput(s, name) {
+		return fmt.Errorf("trigger connected to non-trigger input %q", name)
+	}
+	return nil
+}
+
+// multi is embedded by modules that produce more than one output signal.
+// The module's process method fills all of the output buffers at once,
+// the first time any output is read during a tick. As with Dup, the
+// module must be added to the Engine as a Ticker.
+type multi struct {
+	p    multiProcessor
+	bufs [][]Sample
+	done bool
+}
+
+type multiProcessor interface {
+	Processor
+	process()
+}
+
+func (m *multi) outputs(p multiProcessor, n int) {
+	m.p = p
+	m.bufs = make([][]Sample, n)
+	for i := range m.bufs {
+		m.bufs[i] = make([]Sample, nSamples)
+	}
+}
+
+func (m *multi) Tick() {
+	m.done = false
+}
+
+func (m *multi) output(i int) []Sample {
+	if !m.done {
+		m.done = true
+		m.p.process()
+	}
+	return m.bufs[i]
+}
+
+// multiOutput is a Processor that reads one of the outputs of a multi.
+type multiOutput struct {
+	m *multi
+	i int
+}
+
+func (o multiOutput) Process(s []Sample) {
+	copy(s, o.m.output(o.i))
+}
+
+// aux is an auxiliary output that a module fills in as a side effect of
+// its Process method. A module that reads an aux before its owner has
+// been processed sees the signal from the previous block.
+type aux struct {
+	p Processor
+	b []Sample
+}
+
+func newAux(p Processor) *aux {
+	return &aux{p: p, b: make([]Sample, nSamples)}
+}
+
+func (a *aux) Process(s []Sample) {
+	copy(s, a.b)
+}
+
+// bufferFeed feeds a buffer rendered by a module to an effect it wraps,
+// such as the upsampled input of the fx of an Oversample.
+type bufferFeed struct {
+	b []Sample
+}
 
+func (f *bufferFeed) Process(s []Sample) {
+	copy(s, f.b)
 }
@@ -0,0 +1,83 @@
+/*
+Copyright 2026 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package audio
+
+import "math"
+
+// delayLine is a circular buffer of past samples that can be read at
+// fractional delays, for delay-based effects.
+type delayLine struct {
+	buf []Sample
+	pos int // position in buf of the most recent sample
+}
+
+// newDelayLine returns a delayLine that holds delays of up to max samples.
+func newDelayLine(max int) *delayLine {
+	return &delayLine{buf: make([]Sample, max+1)}
+}
+
+// Write adds x to the line as its most recent sample.
+func (d *delayLine) Write(x Sample) {
+	d.pos++
+	if d.pos == len(d.buf) {
+		d.pos = 0
+	}
+	d.buf[d.pos] = x
+}
+
+// reset clears the line to silence.
+func (d *delayLine) reset() {
+	for i := range d.buf {
+		d.buf[i] = 0
+	}
+}
+
+// Read returns the sample written delay samples before the most recent
+// one. The delay must be within the range the line holds.
+func (d *delayLine) Read(delay int) Sample {
+	j := d.pos - delay
+	if j < 0 {
+		j += len(d.buf)
+	}
+	return d.buf[j]
+}
+
+// ReadFrac returns the sample written delay samples before the most
+// recent one, interpolating linearly between samples. The delay is
+// clamped to the range the line holds.
+func (d *delayLine) ReadFrac(delay float64) Sample {
+	n := len(d.buf)
+	if delay < 0 {
+		delay = 0
+	} else if delay > float64(n-1) {
+		delay = float64(n - 1)
+	}
+	i := int(delay)
+	j := d.pos - i
+	if j < 0 {
+		j += n
+	}
+	a := d.buf[j]
+	f := Sample(delay - math.Floor(delay))
+	if f == 0 {
+		return a
+	}
+	if j--; j < 0 {
+		j += n
+	}
+	return a + (d.buf[j]-a)*f
+}
@@ -0,0 +1,145 @@
+/*
+Copyright 2026 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package audio
+
+import (
+	"errors"
+	"flag"
+	"time"
+
+	"code.google.com/p/portaudio-go/portaudio"
+)
+
+var audioDevice = flag.String("audio_device", "", "audio output device name (empty for the default device)")
+
+// Device describes an audio output device. Portaudio must be initialized
+// before devices are listed or used.
+type Device struct {
+	Name       string
+	SampleRate float64 // native sample rate in Hz
+	Channels   int     // maximum number of output channels
+
+	info *portaudio.DeviceInfo
+}
+
+func newDevice(i *portaudio.DeviceInfo) Device {
+	return Device{
+		Name:       i.Name,
+		SampleRate: i.DefaultSampleRate,
+		Channels:   i.MaxOutputChannels,
+		info:       i,
+	}
+}
+
+// Devices returns the available audio output devices.
+func Devices() ([]Device, error) {
+	infos, err := portaudio.Devices()
+	if err != nil {
+		return nil, err
+	}
+	var ds []Device
+	for _, i := range infos {
+		if i.MaxOutputChannels > 0 {
+			ds = append(ds, newDevice(i))
+		}
+	}
+	return ds, nil
+}
+
+// DefaultDevice returns the system's default audio output device.
+func DefaultDevice() (Device, error) {
+	i, err := portaudio.DefaultOutputDevice()
+	if err != nil {
+		return Device{}, err
+	}
+	return newDevice(i), nil
+}
+
+// LookupDevice returns the audio output device with the given name.
+func LookupDevice(name string) (Device, error) {
+	ds, err := Devices()
+	if err != nil {
+		return Device{}, err
+	}
+	for _, d := range ds {
+		if d.Name == name {
+			return d, nil
+		}
+	}
+	return Device{}, errors.New("unknown audio device: " + name)
+}
+
+// SetDevice selects the device that the Engine plays through when next
+// started. By default the Engine uses the device named by the
+// -audio_device flag, or the system default.
+func (e *Engine) SetDevice(d Device) {
+	e.device = d.info
+}
+
+// stream is the part of a portaudio.Stream that the Engine uses. It is an
+// interface so that tests can stand in for an audio device.
+type stream interface {
+	Start() error
+	Stop() error
+	Abort() error
+	Close() error
+	Info() *portaudio.StreamInfo
+}
+
+// openStream opens an output stream on the Engine's device.
+func (e *Engine) openStream() (stream, error) {
+	dev := e.device
+	if dev == nil && *audioDevice != "" {
+		d, err := LookupDevice(*audioDevice)
+		if err != nil {
+			return nil, err
+		}
+		dev = d.info
+	}
+	var s *portaudio.Stream
+	var err error
+	if dev == nil {
+		s, err = portaudio.OpenDefaultStream(0, nChannels, waveHz, nSamples, e.processAudio)
+	} else {
+		p := portaudio.HighLatencyParameters(nil, dev)
+		p.Output.Channels = nChannels
+		p.SampleRate = waveHz
+		p.FramesPerBuffer = nSamples
+		s, err = portaudio.OpenStream(p, e.processAudio)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// ErrDeviceLost is sent on the channel returned by Lost, and returned by
+// Stop, when the audio device stops calling back while the Engine is
+// started, as when the device is unplugged.
+var ErrDeviceLost = errors.New("audio device stopped responding")
+
+// deviceTimeout is how long the audio device may go without calling back
+// before the Engine considers it lost.
+const deviceTimeout = time.Second
+
+// Lost returns a channel that receives an error if the audio device is
+// lost while the Engine is started. The Engine then closes its stream
+// and plays nothing until it is stopped and started again; Stop returns
+// the same error.
+func (e *Engine) Lost() <-chan error {
+	return e.lost
+}
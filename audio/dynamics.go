@@ -0,0 +1,189 @@
+/*
+Copyright 2026 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package audio
+
+import (
+	"math"
+
+	"github.com/nf/sigourney/fast"
+)
+
+// follower is a peak envelope follower that rises toward the level of its
+// input with an attack time and falls with a release time, in seconds.
+type follower struct {
+	v float64
+
+	att, rel         float64 // times for which the coefficients were computed
+	attCoef, relCoef float64
+}
+
+// coef returns the one-pole smoothing coefficient for time t in seconds.
+func coef(t float64) float64 {
+	if t <= 0 {
+		return 0
+	}
+	return math.Exp(-1 / (t * waveHz))
+}
+
+// next updates the follower with the input sample x and returns the
+// current envelope level.
+func (f *follower) next(x Sample, att, rel Sample) float64 {
+	if a := float64(att); a != f.att {
+		f.att, f.attCoef = a, coef(a)
+	}
+	if r := float64(rel); r != f.rel {
+		f.rel, f.relCoef = r, coef(r)
+	}
+	l := math.Abs(float64(x))
+	c := f.relCoef
+	if l > f.v {
+		c = f.attCoef
+	}
+	f.v = l + c*(f.v-l)
+	return f.v
+}
+
+// LinToDB converts a linear amplitude to decibels, where an amplitude of 1
+// is 0dB.
+func LinToDB(a float64) float64 {
+	return 20 * math.Log10(a)
+}
+
+// DBToLin converts decibels to a linear amplitude. It is the inverse of
+// LinToDB.
+func DBToLin(db float64) float64 {
+	return math.Pow(10, db/20)
+}
+
+// NewGain returns a module that scales its "in" input by its "db" input,
+// in decibels: 0dB leaves the input unchanged, and each 6dB or so doubles
+// or halves its amplitude.
+func NewGain() *Gain {
+	g := &Gain{}
+	g.inputs("in", &g.in, "db", &g.db)
+	return g
+}
+
+type Gain struct {
+	sink
+	in Processor
+	db source
+}
+
+func (g *Gain) Process(s []Sample) {
+	g.in.Process(s)
+	db := g.db.Process()
+	last, k := Sample(0), 1.0
+	for i := range s {
+		if d := db[i]; d != last {
+			last, k = d, fast.Exp2(float64(d)*math.Log2(10)/20)
+		}
+		s[i] *= Sample(k)
+	}
+}
+
+// NewExpander returns a downward expander that reduces the level of its
+// "in" input while it is below "thresh" dB. Below the threshold each dB
+// the input falls becomes "ratio" dB of output, so a ratio of 1 leaves
+// the input unchanged and a high ratio acts as a gate. The input level is
+// tracked by an envelope follower with "att" and "rel" times in seconds.
+func NewExpander() *Expander {
+	x := &Expander{}
+	x.inputs("in", &x.in, "thresh", &x.thresh, "ratio", &x.ratio, "att", &x.att, "rel", &x.rel)
+	x.setDefault("ratio", 1)
+	return x
+}
+
+type Expander struct {
+	sink
+	in                      Processor
+	thresh, ratio, att, rel source
+
+	env follower
+}
+
+func (x *Expander) Process(s []Sample) {
+	x.in.Process(s)
+	thresh, ratio, att, rel := x.thresh.Process(), x.ratio.Process(), x.att.Process(), x.rel.Process()
+	for i := range s {
+		level := LinToDB(x.env.next(s[i], att[i], rel[i]))
+		t, r := float64(thresh[i]), float64(ratio[i])
+		if level >= t || r <= 1 {
+			continue
+		}
+		s[i] *= Sample(DBToLin((level - t) * (r - 1)))
+	}
+}
+
+func (x *Expander) Reset() {
+	x.env.v = 0
+}
+
+// Envelope follower times used by Transient to separate the transient
+// and sustain portions of its input.
+const (
+	transientFastAtt, transientFastRel = 0.0005, 0.02
+	transientSlowAtt, transientSlowRel = 0.02, 0.2
+	transientMaxDB                     = 24
+)
+
+// NewTransient returns a transient shaper that compares a fast and a slow
+// envelope follower of its "in" input to tell transients, where the fast
+// envelope leads, from sustain, where it trails. The gain in dB is the
+// difference between the envelopes scaled by the "attack" input during
+// transients and by the "sustain" input otherwise, so positive values
+// emphasize and negative values soften each portion. At 0 the input
+// passes unchanged.
+func NewTransient() *Transient {
+	t := &Transient{}
+	t.inputs("in", &t.in, "attack", &t.attack, "sustain", &t.sustain)
+	return t
+}
+
+type Transient struct {
+	sink
+	in              Processor
+	attack, sustain source
+
+	fast, slow follower
+}
+
+func (t *Transient) Process(s []Sample) {
+	t.in.Process(s)
+	attack, sustain := t.attack.Process(), t.sustain.Process()
+	for i := range s {
+		f := t.fast.next(s[i], transientFastAtt, transientFastRel)
+		w := t.slow.next(s[i], transientSlowAtt, transientSlowRel)
+		d := LinToDB(f+1e-9) - LinToDB(w+1e-9)
+		var g float64
+		if d > 0 {
+			g = float64(attack[i]) * d
+		} else {
+			g = float64(sustain[i]) * -d
+		}
+		if g > transientMaxDB {
+			g = transientMaxDB
+		} else if g < -transientMaxDB {
+			g = -transientMaxDB
+		}
+		s[i] *= Sample(DBToLin(g))
+	}
+}
+
+func (t *Transient) Reset() {
+	t.fast.v, t.slow.v = 0, 0
+}
@@ -17,13 +17,26 @@ limitations under the License.
 package audio
 
 import (
+	"bufio"
+	"encoding/binary"
+	"io"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"code.google.com/p/portaudio-go/portaudio"
 )
 
+// NewEngine returns an Engine that plays its "in" input through an audio
+// output device. If the input is a StereoProcessor its channels are played
+// in stereo, otherwise the mono signal is played on both channels.
 func NewEngine() *Engine {
-	e := &Engine{done: make(chan error)}
+	e := &Engine{
+		done:  make(chan error),
+		faded: make(chan bool, 1),
+		lost:  make(chan error, 1),
+	}
+	e.open = e.openStream
 	e.inputs("in", &e.in)
 	return e
 }
@@ -32,10 +45,71 @@ type Engine struct {
 	sync.Mutex // Held while processing.
 
 	sink
-	in source
+	in stereoSource
 
 	done    chan error
 	tickers []Ticker
+	device  *portaudio.DeviceInfo
+	open    func() (stream, error) // opens the device; replaced by tests
+
+	called int64      // atomic; time of the device's last callback, in ns
+	lost   chan error // receives ErrDeviceLost
+
+	underruns  int64         // atomic
+	outLatency time.Duration // output latency reported by the device
+
+	stopping int32     // atomic; whether to fade out
+	mute     Sample    // attenuation of the output, from 0 to 1
+	faded    chan bool // receives once the output has faded out
+
+	mon atomic.Value // *monitor; receives copies of the output, if set
+}
+
+// blockTime is the duration of audio in a block.
+const blockTime = time.Duration(nSamples) * time.Second / waveHz
+
+// fadeTime is how long the Engine takes to fade its output in when started
+// and out when stopped, so that starting and stopping don't click.
+const fadeTime = 5 * time.Millisecond
+
+// Underruns returns the number of blocks that the Engine failed to render
+// in time for the audio device, either because processing a block took
+// longer than the block lasts or because the device reported an underflow.
+// A rising count means the patch is too heavy for real-time playback.
+func (e *Engine) Underruns() int64 {
+	return atomic.LoadInt64(&e.underruns)
+}
+
+// Latency returns the time between the Engine rendering a block and the
+// block being heard: the duration of the block itself plus the latency of
+// the audio device, if started. Each Feedback node in the patch adds
+// another block.
+func (e *Engine) Latency() time.Duration {
+	n := 0
+	WalkGraph(e.in.p, func(p Processor) {
+		if _, ok := p.(*Feedback); ok {
+			n++
+		}
+	})
+	return latency(nSamples, n, e.outLatency)
+}
+
+// Seed seeds each module in the Engine's patch that draws random numbers,
+// such as Rand and Walk, with its own seed derived from seed. A patch
+// seeded the same way renders the same output each time, which makes it
+// suitable for tests and reproducible renders.
+func (e *Engine) Seed(seed int64) {
+	WalkGraph(e.in.p, func(p Processor) {
+		if s, ok := p.(seeder); ok {
+			s.Seed(seed)
+			seed++
+		}
+	})
+}
+
+func latency(blockSize, feedbacks int, device time.Duration) time.Duration {
+	block := time.Duration(blockSize) * time.Second / waveHz
+	return block*time.Duration(1+feedbacks) + device
 }
 
 func (e *Engine) AddTicker(t Ticker) {
@@ -53,23 +127,305 @@ func (e *Engine) RemoveTicker(t Ticker) {
 	}
 }
 
-func (e *Engine) processAudio(_, out []int16) {
+// processAudio renders a block into out, which holds nSamples frames of
+// interleaved 16-bit samples: left, right, left, right, and so on.
+func (e *Engine) processAudio(_, out []int16, _ portaudio.StreamCallbackTimeInfo, flags portaudio.StreamCallbackFlags) {
+	start := now()
+	atomic.StoreInt64(&e.called, start.UnixNano())
+	l, r := e.render()
+	e.fade(l, r)
+	e.monitor(l, r, false)
+	if flags&portaudio.OutputUnderflow != 0 || now().Sub(start) > blockTime {
+		atomic.AddInt64(&e.underruns, 1)
+	}
+	for i := range l {
+		out[i*nChannels] = toInt16(l[i])
+		out[i*nChannels+1] = toInt16(r[i])
+	}
+}
+
+// render renders a block from the Engine's input.
+func (e *Engine) render() (l, r []Sample) {
 	e.Lock()
-	buf := e.in.Process()
+	l, r = e.in.Process()
 	for _, t := range e.tickers {
 		t.Tick()
 	}
 	e.Unlock()
-	for i := range buf {
-		out[i] = int16(buf[i] * waveAmp * 0.9)
+	return l, r
+}
+
+// fade ramps the Engine's output towards silence while it is stopping and
+// towards full volume otherwise.
+func (e *Engine) fade(l, r []Sample) {
+	out := atomic.LoadInt32(&e.stopping) != 0
+	if !out && e.mute == 0 {
+		return
+	}
+	step := Sample(time.Second/fadeTime) / waveHz
+	for i := range l {
+		if out {
+			if e.mute += step; e.mute > 1 {
+				e.mute = 1
+			}
+		} else if e.mute -= step; e.mute < 0 {
+			e.mute = 0
+		}
+		l[i] *= 1 - e.mute
+		r[i] *= 1 - e.mute
+	}
+	if out && e.mute == 1 {
+		select {
+		case e.faded <- true:
+		default:
+		}
+	}
+}
+
+// monitorBlocks is the number of blocks that may be handed off to a
+// monitor function before further blocks are dropped.
+const monitorBlocks = 16
+
+// monitor hands off copies of the Engine's output to a function called on
+// its own goroutine, so that the function never holds up the audio.
+type monitor struct {
+	f          func(l, r []Sample)
+	free, full chan [2][]Sample
+	quit, done chan bool
+}
+
+// SetMonitor sets f to be called with each block of the Engine's output,
+// as it is played or rendered, for metering, recording or debugging. The
+// blocks are copies, passed in order on a goroutine of their own; f must
+// not retain or modify them. If f falls more than a few blocks behind the
+// audio device, the blocks it has no room for are dropped rather than
+// delaying the audio; Render and RenderTail instead wait for f to catch
+// up, so it is passed every block.
+//
+// A nil f removes the monitor. SetMonitor returns once any previous
+// monitor has been passed the blocks already handed off to it, so it
+// must not be called from f.
+func (e *Engine) SetMonitor(f func(l, r []Sample)) {
+	var m *monitor
+	if f != nil {
+		m = &monitor{
+			f:    f,
+			free: make(chan [2][]Sample, monitorBlocks),
+			full: make(chan [2][]Sample, monitorBlocks),
+			quit: make(chan bool),
+			done: make(chan bool),
+		}
+		for i := 0; i < monitorBlocks; i++ {
+			m.free <- [2][]Sample{make([]Sample, nSamples), make([]Sample, nSamples)}
+		}
+		go m.run()
+	}
+	old, _ := e.mon.Load().(*monitor)
+	e.mon.Store(m)
+	if old != nil {
+		close(old.quit)
+		<-old.done
+	}
+}
+
+// monitor copies a block of the Engine's output to its monitor, if any.
+// If the monitor is behind, monitor waits for it if wait is set and drops
+// the block otherwise.
+func (e *Engine) monitor(l, r []Sample, wait bool) {
+	m, _ := e.mon.Load().(*monitor)
+	if m == nil {
+		return
+	}
+	var b [2][]Sample
+	select {
+	case b = <-m.free:
+	default:
+		if !wait {
+			return
+		}
+		select {
+		case b = <-m.free:
+		case <-m.done:
+			// The monitor was removed while we waited.
+			return
+		}
+	}
+	copy(b[0], l)
+	copy(b[1], r)
+	m.full <- b
+}
+
+func (m *monitor) run() {
+	defer close(m.done)
+	for {
+		select {
+		case b := <-m.full:
+			m.f(b[0], b[1])
+			m.free <- b
+		case <-m.quit:
+			for {
+				select {
+				case b := <-m.full:
+					m.f(b[0], b[1])
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// Format is an encoding of raw PCM audio.
+type Format struct {
+	Float bool             // 32-bit floating point rather than 16-bit integer samples
+	Order binary.ByteOrder // defaults to little endian if nil
+}
+
+// Render renders the given number of blocks from the Engine's input and
+// writes them to w as raw PCM in the given format, with the channels
+// interleaved as for the audio device. It is for headless and offline use,
+// such as piping to another program, and must not be called while the
+// Engine is started.
+func (e *Engine) Render(w io.Writer, blocks int, f Format) error {
+	pw := newPCMWriter(w, f)
+	for b := 0; b < blocks; b++ {
+		l, r := e.render()
+		e.monitor(l, r, true)
+		if err := pw.write(l, r); err != nil {
+			return err
+		}
+	}
+	return pw.Flush()
+}
+
+// Tail describes when RenderTail considers a patch's tail to have ended.
+type Tail struct {
+	// Threshold is the peak level below which the output is silent.
+	// The default is 0.001, or -60dB.
+	Threshold Sample
+
+	// Hold is how long the output must stay silent for the tail to
+	// end. The default is 100ms.
+	Hold time.Duration
+
+	// Max is the longest tail to render, after which rendering stops
+	// even if the output is not yet silent. The default is 30s.
+	Max time.Duration
+}
+
+// RenderTail is like Render, but after the given number of blocks it goes
+// on rendering the patch's tail, such as the echoes of a delay or the
+// decay of a reverb, until the output falls silent as described by t.
+func (e *Engine) RenderTail(w io.Writer, blocks int, f Format, t Tail) error {
+	if t.Threshold <= 0 {
+		t.Threshold = 0.001
+	}
+	if t.Hold <= 0 {
+		t.Hold = 100 * time.Millisecond
+	}
+	if t.Max <= 0 {
+		t.Max = 30 * time.Second
+	}
+	hold, max := int((t.Hold+blockTime-1)/blockTime), int(t.Max/blockTime)
+	pw := newPCMWriter(w, f)
+	silent := 0
+	for b := 0; b < blocks+max && (b < blocks || silent < hold); b++ {
+		l, r := e.render()
+		e.monitor(l, r, true)
+		if err := pw.write(l, r); err != nil {
+			return err
+		}
+		if peak(l) < t.Threshold && peak(r) < t.Threshold {
+			silent++
+		} else {
+			silent = 0
+		}
+	}
+	return pw.Flush()
+}
+
+// peak returns the largest magnitude in s.
+func peak(s []Sample) Sample {
+	var p Sample
+	for _, v := range s {
+		if v < 0 {
+			v = -v
+		}
+		if v > p {
+			p = v
+		}
 	}
+	return p
 }
 
+// pcmWriter encodes blocks of stereo samples as raw PCM.
+type pcmWriter struct {
+	*bufio.Writer
+	f   Format
+	i16 []int16
+	f32 []float32
+}
+
+func newPCMWriter(w io.Writer, f Format) *pcmWriter {
+	if f.Order == nil {
+		f.Order = binary.LittleEndian
+	}
+	return &pcmWriter{
+		Writer: bufio.NewWriter(w),
+		f:      f,
+		i16:    make([]int16, nSamples*nChannels),
+		f32:    make([]float32, nSamples*nChannels),
+	}
+}
+
+// write writes a block with the given channels.
+func (w *pcmWriter) write(l, r []Sample) error {
+	if w.f.Float {
+		for i := range l {
+			w.f32[i*nChannels] = float32(l[i])
+			w.f32[i*nChannels+1] = float32(r[i])
+		}
+		return binary.Write(w, w.f.Order, w.f32)
+	}
+	for i := range l {
+		w.i16[i*nChannels] = toInt16(l[i])
+		w.i16[i*nChannels+1] = toInt16(r[i])
+	}
+	return binary.Write(w, w.f.Order, w.i16)
+}
+
+// toInt16 converts s to a 16-bit sample, clipping it to the range -1 to 1
+// and leaving some headroom.
+func toInt16(s Sample) int16 {
+	if s > 1 {
+		s = 1
+	} else if s < -1 {
+		s = -1
+	}
+	return int16(s * waveAmp * 0.9)
+}
+
+// Start starts playing the Engine's input through the audio device,
+// fading it in.
 func (e *Engine) Start() error {
-	stream, err := portaudio.OpenDefaultStream(0, 1, waveHz, nSamples, e.processAudio)
+	stream, err := e.open()
 	if err != nil {
 		return err
 	}
+	e.mute = 1
+	atomic.StoreInt32(&e.stopping, 0)
+	select {
+	case <-e.faded:
+	default:
+	}
+	select {
+	case <-e.lost:
+	default:
+	}
+	if i := stream.Info(); i != nil {
+		e.outLatency = i.OutputLatency
+	}
+	atomic.StoreInt64(&e.called, now().UnixNano())
 	errc := make(chan error)
 	go func() {
 		err = stream.Start()
@@ -77,17 +433,48 @@ func (e *Engine) Start() error {
 		if err != nil {
 			return
 		}
-		<-e.done
-		err = stream.Stop()
-		if err == nil {
-			err = stream.Close()
-		}
-		e.done <- err
+		e.done <- e.watch(stream)
 	}()
 	return <-errc
 }
 
+// watch waits for Stop while the stream plays, checking that the device
+// keeps calling back, and returns the error from stopping the stream. If
+// the device is lost, watch aborts the stream and reports it on e.lost.
+func (e *Engine) watch(s stream) error {
+	t := time.NewTicker(deviceTimeout / 4)
+	defer t.Stop()
+	for {
+		select {
+		case <-e.done:
+			err := s.Stop()
+			if err == nil {
+				err = s.Close()
+			}
+			return err
+		case <-t.C:
+			if now().Sub(time.Unix(0, atomic.LoadInt64(&e.called))) < deviceTimeout {
+				continue
+			}
+			s.Abort()
+			s.Close()
+			e.lost <- ErrDeviceLost
+			<-e.done
+			return ErrDeviceLost
+		}
+	}
+}
+
+// Stop fades out the Engine's output and stops the audio device. If the
+// device was lost while the Engine was started, Stop returns
+// ErrDeviceLost.
 func (e *Engine) Stop() error {
+	atomic.StoreInt32(&e.stopping, 1)
+	select {
+	case <-e.faded:
+	case <-time.After(fadeTime + 4*blockTime):
+		// The device has stopped calling back.
+	}
 	e.done <- nil
 	return <-e.done
 }
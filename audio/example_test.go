@@ -0,0 +1,69 @@
+/*
+Copyright 2026 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package audio_test
+
+import (
+	"fmt"
+
+	"github.com/nf/sigourney/audio"
+)
+
+// OnePole is a low-pass filter defined outside package audio. Each sample
+// it moves a fraction "k" of the way toward its "in" input, and it returns
+// to zero on each "reset" trigger.
+type OnePole struct {
+	audio.Module
+	in    audio.Processor
+	k     audio.Source
+	reset audio.TriggerSource
+
+	y audio.Sample
+}
+
+func NewOnePole() *OnePole {
+	f := &OnePole{}
+	f.Register("in", &f.in, "k", &f.k, "reset", &f.reset)
+	f.SetDefault("k", 0.5)
+	return f
+}
+
+func (f *OnePole) Process(s []audio.Sample) {
+	f.in.Process(s)
+	k, reset := f.k.Process(), f.reset.Process()
+	for i, x := range s {
+		if f.reset.Next(reset[i]) {
+			f.y = 0
+		}
+		f.y += k[i] * (x - f.y)
+		s[i] = f.y
+	}
+}
+
+func ExampleModule() {
+	f := NewOnePole()
+	f.Input("in", audio.Value(1))
+	fmt.Println(f.Inputs())
+	fmt.Println(audio.IsTriggerInput(f, "reset"), audio.CheckTrigger(f, "reset", audio.NewClock()))
+
+	s := make([]audio.Sample, audio.BlockSize)
+	f.Process(s)
+	fmt.Println(s[:4])
+	// Output:
+	// [in k reset]
+	// true <nil>
+	// [0.5 0.75 0.875 0.9375]
+}
@@ -0,0 +1,440 @@
+/*
+Copyright 2026 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package audio
+
+import "math"
+
+// butterworthQ is the q of a second-order Butterworth filter. Two in
+// series make a fourth-order Linkwitz-Riley filter.
+const butterworthQ = math.Sqrt2 / 2
+
+// biquad is a second-order IIR filter section, in transposed direct form
+// II, with coefficients normalized so that a0 is 1.
+type biquad struct {
+	b0, b1, b2, a1, a2 float64
+	z1, z2             float64
+}
+
+func (f *biquad) next(x float64) float64 {
+	y := f.b0*x + f.z1
+	f.z1 = f.b1*x - f.a1*y + f.z2
+	f.z2 = f.b2*x - f.a2*y
+	return y
+}
+
+// reset clears the filter's state.
+func (f *biquad) reset() {
+	f.z1, f.z2 = 0, 0
+}
+
+// set sets the coefficients of f, normalizing them by a0. The filter state
+// is kept, so that coefficients may change while the filter runs.
+func (f *biquad) set(b0, b1, b2, a0, a1, a2 float64) {
+	f.b0, f.b1, f.b2 = b0/a0, b1/a0, b2/a0
+	f.a1, f.a2 = a1/a0, a2/a0
+}
+
+// peaking makes f a peaking EQ boosting or cutting by gain decibels around
+// hz, with bandwidth set by q.
+func (f *biquad) peaking(hz, q, gain float64) {
+	a := math.Pow(10, gain/40)
+	w := 2 * math.Pi * hz / waveHz
+	alpha := math.Sin(w) / (2 * q)
+	cos := math.Cos(w)
+	f.set(1+alpha*a, -2*cos, 1-alpha*a, 1+alpha/a, -2*cos, 1-alpha/a)
+}
+
+// lowpass makes f a low-pass filter cut off at hz, with resonance q.
+func (f *biquad) lowpass(hz, q float64) {
+	w := 2 * math.Pi * hz / waveHz
+	alpha := math.Sin(w) / (2 * q)
+	cos := math.Cos(w)
+	f.set((1-cos)/2, 1-cos, (1-cos)/2, 1+alpha, -2*cos, 1-alpha)
+}
+
+// highpass makes f a high-pass filter cut off at hz, with resonance q.
+func (f *biquad) highpass(hz, q float64) {
+	w := 2 * math.Pi * hz / waveHz
+	alpha := math.Sin(w) / (2 * q)
+	cos := math.Cos(w)
+	f.set((1+cos)/2, -1-cos, (1+cos)/2, 1+alpha, -2*cos, 1-alpha)
+}
+
+// allpass makes f an all-pass filter whose phase shift is centred on hz.
+func (f *biquad) allpass(hz, q float64) {
+	w := 2 * math.Pi * hz / waveHz
+	alpha := math.Sin(w) / (2 * q)
+	cos := math.Cos(w)
+	f.set(1-alpha, -2*cos, 1+alpha, 1+alpha, -2*cos, 1-alpha)
+}
+
+// shelf makes f a shelving filter changing the gain by gain decibels
+// below hz or, if high is set, above it.
+func (f *biquad) shelf(hz, gain float64, high bool) {
+	a := math.Pow(10, gain/40)
+	w := 2 * math.Pi * hz / waveHz
+	cos := math.Cos(w)
+	beta := 2 * math.Sqrt(a) * math.Sin(w) / math.Sqrt2 // 2*sqrt(A)*alpha, for a slope of 1
+	if high {
+		f.set(
+			a*((a+1)+(a-1)*cos+beta),
+			-2*a*((a-1)+(a+1)*cos),
+			a*((a+1)+(a-1)*cos-beta),
+			(a+1)-(a-1)*cos+beta,
+			2*((a-1)-(a+1)*cos),
+			(a+1)-(a-1)*cos-beta,
+		)
+		return
+	}
+	f.set(
+		a*((a+1)-(a-1)*cos+beta),
+		2*a*((a-1)-(a+1)*cos),
+		a*((a+1)-(a-1)*cos-beta),
+		(a+1)+(a-1)*cos+beta,
+		-2*((a-1)+(a+1)*cos),
+		(a+1)+(a-1)*cos-beta,
+	)
+}
+
+// NewLowPass returns a resonant low-pass filter for its "in" input. Its
+// "cutoff" input is a pitch, like that of an oscillator, so that it may be
+// modulated in octaves; the cutoff frequency is limited to just below the
+// Nyquist frequency. Its "res" input is the q of the filter, 0.707 by
+// default for a flat response.
+func NewLowPass() *LowPass {
+	f := &LowPass{cutoff: -1}
+	f.inputs("in", &f.in, "cutoff", &f.cutoffIn, "res", &f.resIn)
+	f.setDefault("res", butterworthQ)
+	return f
+}
+
+type LowPass struct {
+	sink
+	in              Processor
+	cutoffIn, resIn source
+
+	cutoff, res Sample // parameters of f
+	f           biquad
+}
+
+func (f *LowPass) Process(s []Sample) {
+	f.in.Process(s)
+	cutoff, res := f.cutoffIn.Process(), f.resIn.Process()
+	for i, v := range s {
+		if cutoff[i] != f.cutoff || res[i] != f.res {
+			f.cutoff, f.res = cutoff[i], res[i]
+			hz := math.Min(SampleToHz(f.cutoff), waveHz*0.49)
+			q := math.Max(float64(f.res), 0.1)
+			f.f.lowpass(hz, q)
+		}
+		s[i] = Sample(f.f.next(float64(v)))
+	}
+}
+
+// Reset clears the filter's state.
+func (f *LowPass) Reset() {
+	f.f.reset()
+}
+
+// Centre frequencies of the ISO octave and third-octave bands.
+var (
+	octaveBands      = []float64{31.5, 63, 125, 250, 500, 1000, 2000, 4000, 8000, 16000}
+	thirdOctaveBands = []float64{
+		20, 25, 31.5, 40, 50, 63, 80, 100, 125, 160,
+		200, 250, 315, 400, 500, 630, 800, 1000, 1250, 1600,
+		2000, 2500, 3150, 4000, 5000, 6300, 8000, 10000, 12500, 16000,
+		20000,
+	}
+)
+
+// NewGraphicEQ returns a graphic equalizer for its "in" input, with either
+// 10 octave bands or 31 third-octave bands at the ISO centre frequencies.
+// Each band is a constant-Q peaking filter whose gain is set by SetGain.
+func NewGraphicEQ(bands int) *GraphicEQ {
+	var hz []float64
+	var octaves float64
+	switch bands {
+	case len(octaveBands):
+		hz, octaves = octaveBands, 1
+	case len(thirdOctaveBands):
+		hz, octaves = thirdOctaveBands, 1.0/3
+	default:
+		panic("graphic EQ must have 10 or 31 bands")
+	}
+	n := math.Exp2(octaves)
+	e := &GraphicEQ{
+		hz:    hz,
+		q:     math.Sqrt(n) / (n - 1),
+		gain:  make([]float64, bands),
+		dirty: make([]bool, bands),
+		f:     make([]biquad, bands),
+	}
+	for i := range e.f {
+		e.f[i].peaking(hz[i], e.q, 0)
+	}
+	e.inputs("in", &e.in)
+	return e
+}
+
+type GraphicEQ struct {
+	sink
+	in Processor
+
+	hz    []float64 // centre frequency of each band
+	q     float64
+	gain  []float64 // in decibels
+	dirty []bool    // whether the filter for each band needs updating
+	f     []biquad
+}
+
+// Bands returns the centre frequency of each band, in Hz.
+func (e *GraphicEQ) Bands() []float64 {
+	return e.hz
+}
+
+// SetGain sets the gain of the given band, in decibels. Like Input, it
+// must not be called while the EQ is being processed.
+func (e *GraphicEQ) SetGain(band int, db float64) {
+	if e.gain[band] != db {
+		e.gain[band] = db
+		e.dirty[band] = true
+	}
+}
+
+func (e *GraphicEQ) Process(s []Sample) {
+	e.in.Process(s)
+	for i := range e.f {
+		f := &e.f[i]
+		if e.dirty[i] {
+			f.peaking(e.hz[i], e.q, e.gain[i])
+			e.dirty[i] = false
+		}
+		for j, v := range s {
+			s[j] = Sample(f.next(float64(v)))
+		}
+	}
+}
+
+// Reset clears the state of the filters.
+func (e *GraphicEQ) Reset() {
+	for i := range e.f {
+		e.f[i].reset()
+	}
+}
+
+// NewLowShelf returns a filter that changes the gain of its "in" input
+// below "freq" Hz (1000 by default) by "gain" decibels.
+func NewLowShelf() *Shelf {
+	return newShelf(false)
+}
+
+// NewHighShelf returns a filter that changes the gain of its "in" input
+// above "freq" Hz (1000 by default) by "gain" decibels.
+func NewHighShelf() *Shelf {
+	return newShelf(true)
+}
+
+func newShelf(high bool) *Shelf {
+	f := &Shelf{high: high, freq: -1}
+	f.inputs("in", &f.in, "freq", &f.freqIn, "gain", &f.gainIn)
+	f.setDefault("freq", 1000)
+	return f
+}
+
+type Shelf struct {
+	sink
+	in             Processor
+	freqIn, gainIn source
+
+	high       bool
+	freq, gain Sample // parameters of f
+	f          biquad
+}
+
+func (f *Shelf) Process(s []Sample) {
+	f.in.Process(s)
+	freq, gain := f.freqIn.Process(), f.gainIn.Process()
+	for i, v := range s {
+		if freq[i] != f.freq || gain[i] != f.gain {
+			f.freq, f.gain = freq[i], gain[i]
+			f.f.shelf(float64(f.freq), float64(f.gain), f.high)
+		}
+		s[i] = Sample(f.f.next(float64(v)))
+	}
+}
+
+// Reset clears the filter's state.
+func (f *Shelf) Reset() {
+	f.f.reset()
+}
+
+// NewMultiband returns a Multiband that splits its "in" input into
+// len(crossovers)+1 frequency bands, divided at the given frequencies in
+// ascending order, for processing separately. The bands are read from
+// Band, and the Multiband itself outputs their sum. It must be added to
+// the Engine as a Ticker.
+//
+// The bands are split by fourth-order Linkwitz-Riley crossovers, and each
+// band is passed through all-pass filters matching the crossovers above
+// it, so that the bands sum to the input with a flat frequency response,
+// though with its phase shifted.
+func NewMultiband(crossovers []float64) *Multiband {
+	n := len(crossovers)
+	m := &Multiband{bands: make([]mbBand, n+1)}
+	for i := range m.bands {
+		b := &m.bands[i]
+		if i == n {
+			break
+		}
+		b.lp[0].lowpass(crossovers[i], butterworthQ)
+		b.lp[1].lowpass(crossovers[i], butterworthQ)
+		b.hp[0].highpass(crossovers[i], butterworthQ)
+		b.hp[1].highpass(crossovers[i], butterworthQ)
+		for _, hz := range crossovers[i+1:] {
+			var f biquad
+			f.allpass(hz, butterworthQ)
+			b.ap = append(b.ap, f)
+		}
+	}
+	m.inputs("in", &m.in)
+	m.outputs(m, n+2)
+	return m
+}
+
+type Multiband struct {
+	sink
+	multi
+	in source
+
+	bands []mbBand
+}
+
+// mbBand holds the filters for one band of a Multiband: the crossover to
+// the bands above it, and all-pass filters matching the crossovers above.
+type mbBand struct {
+	lp, hp [2]biquad
+	ap     []biquad
+}
+
+// Band returns the output for band i, counting up from the lowest.
+func (m *Multiband) Band(i int) Processor {
+	return multiOutput{&m.multi, i}
+}
+
+func (m *Multiband) Process(s []Sample) {
+	copy(s, m.output(len(m.bands)))
+}
+
+func (m *Multiband) process() {
+	in, sum := m.in.Process(), m.bufs[len(m.bands)]
+	last := len(m.bands) - 1
+	for i, v := range in {
+		rest := float64(v)
+		var total float64
+		for j := range m.bands {
+			b := &m.bands[j]
+			x := rest
+			if j < last {
+				x = b.lp[1].next(b.lp[0].next(rest))
+				rest = b.hp[1].next(b.hp[0].next(rest))
+			}
+			for k := range b.ap {
+				x = b.ap[k].next(x)
+			}
+			m.bufs[j][i] = Sample(x)
+			total += x
+		}
+		sum[i] = Sample(total)
+	}
+}
+
+// Reset clears the state of the filters.
+func (m *Multiband) Reset() {
+	for i := range m.bands {
+		b := &m.bands[i]
+		for j := range b.lp {
+			b.lp[j].reset()
+			b.hp[j].reset()
+		}
+		for j := range b.ap {
+			b.ap[j].reset()
+		}
+	}
+}
+
+// NewDecimate returns a Decimate that reduces the sample rate of its "in"
+// input to "rate" Hz by holding each sample it takes until the next. The
+// output is aliased, for lo-fi effects, unless made clean by SetClean.
+func NewDecimate() *Decimate {
+	d := &Decimate{take: true}
+	d.inputs("in", &d.in, "rate", &d.rate)
+	d.setDefault("rate", waveHz)
+	return d
+}
+
+type Decimate struct {
+	sink
+	in   Processor
+	rate source
+
+	clean bool
+	lp    [2]biquad // anti-aliasing filter, when clean
+	lpHz  Sample    // rate for which lp was computed
+
+	phase float64 // sum of the rate since the last sample taken, below waveHz
+	take  bool    // whether to take the next input sample
+	hold  Sample
+}
+
+// SetClean sets whether the input is low-pass filtered below the Nyquist
+// frequency of the reduced rate before it is decimated, which removes most
+// of the aliasing.
+func (d *Decimate) SetClean(clean bool) {
+	d.clean = clean
+}
+
+func (d *Decimate) Process(s []Sample) {
+	d.in.Process(s)
+	rate := d.rate.Process()
+	for i, v := range s {
+		r := rate[i]
+		if d.clean && r < waveHz/2 {
+			if r != d.lpHz {
+				d.lpHz = r
+				d.lp[0].lowpass(float64(r)*0.45, butterworthQ)
+				d.lp[1].lowpass(float64(r)*0.45, butterworthQ)
+			}
+			v = Sample(d.lp[1].next(d.lp[0].next(float64(v))))
+		}
+		if d.take {
+			d.hold = v
+		}
+		d.phase += float64(r)
+		if d.take = d.phase >= waveHz; d.take {
+			// Wrap rather than subtract, as a rate above waveHz
+			// would otherwise make the phase grow without bound.
+			d.phase = math.Mod(d.phase, waveHz)
+		}
+		s[i] = d.hold
+	}
+}
+
+func (d *Decimate) Reset() {
+	d.lp[0].reset()
+	d.lp[1].reset()
+	d.phase, d.take, d.hold = 0, true, 0
+}
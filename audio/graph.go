@@ -0,0 +1,329 @@
+/*
+Copyright 2026 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package audio
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// WalkGraph calls fn for each node in the graph of Processors that feed
+// root, including root itself, visiting each node exactly once. Outputs
+// of a Dup or of a multi-output module are treated as the node that
+// produces them, so a node shared by several consumers is visited once,
+// and cycles in the graph are followed only once. Value nodes are
+// compared by value, so equal constants are visited once. Nodes are
+// otherwise identified as described by nodeKey.
+func WalkGraph(root Processor, fn func(Processor)) {
+	seen := make(map[interface{}]bool)
+	var walk func(p Processor)
+	walk = func(p Processor) {
+		p = node(p)
+		if p == nil {
+			return
+		}
+		k := nodeKey(p)
+		if seen[k] {
+			return
+		}
+		seen[k] = true
+		fn(p)
+		for _, c := range children(p) {
+			walk(c)
+		}
+	}
+	walk(root)
+}
+
+// refKey identifies a slice or map node, whose type can't be compared, by
+// the address of its data.
+type refKey struct {
+	t reflect.Type
+	p uintptr
+	n int
+}
+
+// nodeKey returns a map key that identifies the node p, which would
+// make a map keyed by Processor panic if its type can't be compared. A
+// slice or map is identified by its type and the address of its data. A
+// func can't be told apart from another made from the same code, so each
+// is given a key of its own and visited wherever it is reached. Any other
+// Processor whose type can't be compared must be made a pointer type;
+// nodeKey panics on one.
+func nodeKey(p interface{}) interface{} {
+	t := reflect.TypeOf(p)
+	if t == nil || t.Comparable() {
+		return p
+	}
+	switch v := reflect.ValueOf(p); v.Kind() {
+	case reflect.Slice:
+		return refKey{t, v.Pointer(), v.Len()}
+	case reflect.Map:
+		return refKey{t, v.Pointer(), 0}
+	case reflect.Func:
+		return new(byte)
+	}
+	panic(fmt.Sprintf("audio: Processor type %v is not comparable; use a pointer to it", t))
+}
+
+// An alias is a Processor that renders an output of some other node.
+type alias interface {
+	node() Processor
+}
+
+func (o *Output) node() Processor     { return o.d.src }
+func (o multiOutput) node() Processor { return o.m.p }
+func (a *aux) node() Processor        { return a.p }
+
+// node returns the graph node that p renders.
+func node(p Processor) Processor {
+	for {
+		a, ok := p.(alias)
+		if !ok {
+			return p
+		}
+		p = a.node()
+	}
+}
+
+// inputter is implemented by modules that embed a sink.
+type inputter interface {
+	Inputs() []string
+	input(name string) Processor
+}
+
+// input returns the Processor connected to the named input.
+func (s *sink) input(name string) Processor {
+	switch v := s.m[name].(type) {
+	case *Processor:
+		return *v
+	case *source:
+		return v.p
+	case *trigger:
+		return v.p
+	case *stereoSource:
+		return v.p
+	}
+	return nil
+}
+
+// ResetAll resets each Resetter in the graph feeding root, and the edge
+// detection of every trigger input, so that the graph plays as if new.
+// Like Input, it must not be called while the graph is being processed.
+func ResetAll(root Processor) {
+	WalkGraph(root, func(p Processor) {
+		if r, ok := p.(Resetter); ok {
+			r.Reset()
+		}
+		if t, ok := p.(interface {
+			resetTriggers()
+		}); ok {
+			t.resetTriggers()
+		}
+	})
+}
+
+// An edge connects a Processor to the named input of the node it feeds.
+type edge struct {
+	input string
+	p     Processor
+}
+
+// edges returns the edges into p, ordered by input name.
+func edges(p Processor) []edge {
+	var e []edge
+	switch v := p.(type) {
+	case *Oversample:
+		e = append(e, edge{"in", v.in}, edge{"fx", v.fx})
+	case *WetDry:
+		e = append(e, edge{"in", v.in}, edge{"mix", v.mix.p}, edge{"fx", v.fx})
+	case *modDest:
+		e = append(e, edge{"base", v.base})
+		for _, r := range v.routes {
+			e = append(e, edge{"route", r.atten})
+		}
+	case inputter:
+		for _, name := range v.Inputs() {
+			e = append(e, edge{name, v.input(name)})
+		}
+	case *Split:
+		e = append(e, edge{"in", v.p})
+	}
+	return e
+}
+
+// children returns the Processors connected to p's inputs, ordered by
+// input name.
+func children(p Processor) []Processor {
+	var c []Processor
+	for _, e := range edges(p) {
+		c = append(c, e.p)
+	}
+	return c
+}
+
+// Tickers returns the Tickers in the graph feeding root: the Dups whose
+// Outputs it uses and any multi-output modules. A host must add these to
+// the Engine for the graph to render correctly.
+func Tickers(root Processor) []Ticker {
+	var ts []Ticker
+	seen := make(map[interface{}]bool)
+	add := func(t Ticker) {
+		if k := nodeKey(t); !seen[k] {
+			seen[k] = true
+			ts = append(ts, t)
+		}
+	}
+	WalkGraph(root, func(p Processor) {
+		if t, ok := p.(Ticker); ok {
+			add(t)
+		}
+		for _, c := range children(p) {
+			for {
+				if o, ok := c.(*Output); ok {
+					add(o.d)
+				}
+				a, ok := c.(alias)
+				if !ok {
+					break
+				}
+				c = a.node()
+			}
+		}
+	})
+	return ts
+}
+
+// CheckLoops returns an error if the graph feeding root contains a loop
+// that does not pass through the Return of a Feedback. Processing such a
+// loop recurses forever, as each module in it renders its inputs before
+// its output.
+func CheckLoops(root Processor) error {
+	const (
+		visiting = iota + 1
+		visited
+	)
+	state := make(map[interface{}]int)
+	var visit func(p Processor) error
+	visit = func(p Processor) error {
+		p = node(p)
+		k := nodeKey(p)
+		switch state[k] {
+		case visiting:
+			return fmt.Errorf("loop through %T without a Feedback", p)
+		case visited:
+			return nil
+		}
+		state[k] = visiting
+		for _, c := range children(p) {
+			if c == nil || isReturn(c) {
+				continue
+			}
+			if err := visit(c); err != nil {
+				return err
+			}
+		}
+		state[k] = visited
+		return nil
+	}
+	return visit(root)
+}
+
+// isReturn reports whether p is the Return of a Feedback, which breaks
+// any loop it closes by delaying it a block.
+func isReturn(p Processor) bool {
+	for {
+		if a, ok := p.(*aux); ok {
+			_, ok := a.p.(*Feedback)
+			return ok
+		}
+		a, ok := p.(alias)
+		if !ok {
+			return false
+		}
+		p = a.node()
+	}
+}
+
+// ExportDOT returns a description of the graph feeding root in the DOT
+// language of Graphviz, for inspecting a patch, as with
+//
+//	dot -Tsvg patch.dot > patch.svg
+//
+// Each module is a node labeled with its type, and each connection an edge
+// labeled with the name of the input it feeds; an edge from an output
+// other than a module's first is also labeled with the output's number.
+// A Dup is a node of its own, fanning out to its consumers, while Values
+// are nodes labeled with their value, shared by the inputs they feed.
+func ExportDOT(root Processor) string {
+	var b bytes.Buffer
+	b.WriteString("digraph patch {\n")
+	ids := make(map[interface{}]string)
+	newID := func(key interface{}, label string) string {
+		id := fmt.Sprintf("n%d", len(ids))
+		ids[key] = id
+		fmt.Fprintf(&b, "\t%s [label=%q];\n", id, label)
+		return id
+	}
+	var visit func(p Processor) string
+	visit = func(p Processor) string {
+		if o, ok := p.(*Output); ok {
+			id, ok := ids[o.d]
+			if !ok {
+				id = newID(o.d, "Dup")
+				fmt.Fprintf(&b, "\t%s -> %s;\n", visit(o.d.src), id)
+			}
+			return id
+		}
+		p = node(p)
+		k := nodeKey(p)
+		if id, ok := ids[k]; ok {
+			return id
+		}
+		id := newID(k, dotLabel(p))
+		for _, e := range edges(p) {
+			if e.p == nil {
+				continue
+			}
+			label := e.input
+			out := e.p
+			if t, ok := out.(triggerOutput); ok {
+				out = t.Processor
+			}
+			if m, ok := out.(multiOutput); ok && m.i > 0 {
+				label += fmt.Sprintf(" (output %d)", m.i)
+			}
+			fmt.Fprintf(&b, "\t%s -> %s [label=%q];\n", visit(e.p), id, label)
+		}
+		return id
+	}
+	visit(root)
+	b.WriteString("}\n")
+	return b.String()
+}
+
+// dotLabel returns the label of p in ExportDOT: its type, without the
+// package, or the value of a Value.
+func dotLabel(p Processor) string {
+	if v, ok := p.(Value); ok {
+		return fmt.Sprintf("Value %v", float64(v))
+	}
+	t := strings.TrimPrefix(fmt.Sprintf("%T", p), "*")
+	return t[strings.LastIndex(t, ".")+1:]
+}
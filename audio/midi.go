@@ -19,6 +19,7 @@ package audio
 import (
 	"flag"
 	"log"
+	"math"
 	"sync"
 	"sync/atomic"
 
@@ -38,48 +39,397 @@ func initMidi() {
 	go midiLoop(s)
 }
 
-var midiNote, midiGate int64 // atomic
+var (
+	midiNote, midiGate, midiVel, midiBend int64 // atomic
+	midiModWheel, midiPressure            int64 // atomic
+	midiTrig                              int64 // atomic; counts notes that should retrigger the gate
+	midiPriority                          int64 // atomic; a NotePriority
+	midiLegato                            int64 // atomic; 1 if legato
+)
+
+// midiHeld is the stack of held notes, most recently pressed last. It is
+// only accessed by handleMidi.
+var midiHeld []int64
+
+// NotePriority selects which of the held notes sounds on the monophonic
+// MIDI input.
+type NotePriority int
+
+const (
+	LastNote    NotePriority = iota // the most recently pressed
+	HighestNote                     // the highest held
+	LowestNote                      // the lowest held
+)
+
+// SetNotePriority sets which of the held notes sounds. A change of note
+// caused by pressing a key retriggers the gate; falling back to another
+// held note when the sounding key is released does not.
+func SetNotePriority(p NotePriority) {
+	atomic.StoreInt64(&midiPriority, int64(p))
+}
+
+// SetLegato turns legato mode on or off. In legato mode, a note pressed
+// while another is held changes the pitch without retriggering the gate,
+// and MidiNote glides to it.
+func SetLegato(on bool) {
+	var v int64
+	if on {
+		v = 1
+	}
+	atomic.StoreInt64(&midiLegato, v)
+}
 
 func midiLoop(s *portmidi.Stream) {
-	var n int64
 	for e := range s.Listen() {
-		switch e.Status {
-		case 144: // note on
-			n = e.Data1
+		handleMidi(e)
+	}
+}
+
+func handleMidi(e portmidi.Event) {
+	switch e.Status {
+	case 144: // note on
+		if e.Data2 == 0 {
+			noteOff(e.Data1)
+			break
+		}
+		noteOff(e.Data1)
+		midiHeld = append(midiHeld, e.Data1)
+		n, open := soundingNote(), atomic.LoadInt64(&midiGate) == 1
+		if n != atomic.LoadInt64(&midiNote) || !open {
 			atomic.StoreInt64(&midiNote, n)
-			atomic.StoreInt64(&midiGate, 1)
-		case 128: // note off
-			if e.Data1 == n {
-				atomic.StoreInt64(&midiGate, 0)
+			atomic.StoreInt64(&midiVel, e.Data2)
+			if !open || atomic.LoadInt64(&midiLegato) == 0 {
+				atomic.AddInt64(&midiTrig, 1)
+			}
+		}
+		atomic.StoreInt64(&midiGate, 1)
+	case 128: // note off
+		noteOff(e.Data1)
+		if len(midiHeld) == 0 {
+			atomic.StoreInt64(&midiGate, 0)
+		} else {
+			atomic.StoreInt64(&midiNote, soundingNote())
+		}
+	case 176: // control change
+		if e.Data1 == 1 { // mod wheel
+			atomic.StoreInt64(&midiModWheel, e.Data2)
+		}
+	case 208: // channel aftertouch
+		atomic.StoreInt64(&midiPressure, e.Data1)
+	case 224: // pitch bend
+		atomic.StoreInt64(&midiBend, (e.Data2<<7|e.Data1)-8192)
+	}
+}
+
+// noteOff removes n from the held notes.
+func noteOff(n int64) {
+	for i, m := range midiHeld {
+		if m == n {
+			midiHeld = append(midiHeld[:i], midiHeld[i+1:]...)
+			return
+		}
+	}
+}
+
+// soundingNote returns the held note chosen by the note priority.
+func soundingNote() int64 {
+	n := midiHeld[len(midiHeld)-1]
+	switch NotePriority(atomic.LoadInt64(&midiPriority)) {
+	case HighestNote:
+		for _, m := range midiHeld {
+			if m > n {
+				n = m
+			}
+		}
+	case LowestNote:
+		for _, m := range midiHeld {
+			if m < n {
+				n = m
 			}
 		}
 	}
+	return n
+}
+
+// midiSmooth is the time in seconds over which MIDI controls are
+// smoothed, to hide the steps between their values.
+const midiSmooth = 0.01
+
+// control is a MIDI control value, smoothed toward its latest value.
+type control struct {
+	v float64
+}
+
+// process fills s with the control value as it moves toward target.
+func (c *control) process(s []Sample, target float64) {
+	k := coef(midiSmooth)
+	for i := range s {
+		c.v = target + k*(c.v-target)
+		s[i] = Sample(c.v)
+	}
+}
+
+// NoteToPitch returns the pitch of the given MIDI note number.
+func NoteToPitch(n int) Sample {
+	return Sample(n-69) / 120
+}
+
+// PitchToNote returns the MIDI note number, possibly fractional, of the
+// given pitch. Use AsInt to find the nearest note.
+func PitchToNote(p Sample) Sample {
+	return p*120 + 69
 }
 
 func NewMidiNote() *MidiNote {
 	initMidiOnce.Do(initMidi)
-	return &MidiNote{}
+	m := &MidiNote{trig: -1}
+	m.inputs("glide", &m.glide)
+	return m
 }
 
-type MidiNote struct{}
+// MidiNote outputs the pitch of the current note. In legato mode it
+// glides from one note to the next over "glide" seconds; notes that
+// retrigger the gate start at their pitch.
+type MidiNote struct {
+	sink
+	glide source
+
+	trig int64 // value of midiTrig at the last block
+	slew slew
+}
+
+// IntValue returns the number of the current note.
+func (m *MidiNote) IntValue() int {
+	return int(atomic.LoadInt64(&midiNote))
+}
 
 func (m *MidiNote) Process(s []Sample) {
-	p := (Sample(atomic.LoadInt64(&midiNote)) - 69) / 120
+	p := NoteToPitch(int(atomic.LoadInt64(&midiNote)))
+	if t := atomic.LoadInt64(&midiTrig); t != m.trig {
+		m.trig = t
+		m.slew.v = float64(p)
+	}
+	glide := m.glide.Process()
 	for i := range s {
-		s[i] = p
+		s[i] = m.slew.next(p, glide[i])
 	}
 }
 
+// Reset ends any glide, so that the next block starts at the current
+// note's pitch.
+func (m *MidiNote) Reset() {
+	m.trig = -1
+	m.slew = slew{}
+}
+
 func NewMidiGate() *MidiGate {
 	initMidiOnce.Do(initMidi)
-	return &MidiGate{}
+	return &MidiGate{trig: atomic.LoadInt64(&midiTrig)}
 }
 
-type MidiGate struct{}
+// MidiGate outputs 1 while a note is held. When a new note sounds while
+// the gate is open, the gate closes for the first sample of the next block
+// so that envelopes retrigger.
+type MidiGate struct {
+	trig int64 // value of midiTrig at the last block
+}
 
 func (m *MidiGate) Process(s []Sample) {
 	p := Sample(atomic.LoadInt64(&midiGate))
 	for i := range s {
 		s[i] = p
 	}
+	if t := atomic.LoadInt64(&midiTrig); t != m.trig {
+		m.trig = t
+		s[0] = 0
+	}
+}
+
+// Reset forgets any note sounded since the last block, as when new.
+func (m *MidiGate) Reset() {
+	m.trig = atomic.LoadInt64(&midiTrig)
+}
+
+func NewMidiVelocity() *MidiVelocity {
+	initMidiOnce.Do(initMidi)
+	return &MidiVelocity{}
+}
+
+// MidiVelocity outputs the velocity of the current note, from 0 to 1.
+type MidiVelocity struct{}
+
+func (m *MidiVelocity) Process(s []Sample) {
+	v := Sample(atomic.LoadInt64(&midiVel)) / 127
+	for i := range s {
+		s[i] = v
+	}
+}
+
+// Velocity curves, for the "curve" input of a Velocity.
+const (
+	VelLinear = iota
+	VelExp    // soft notes quieter, for a wide dynamic range
+	VelLog    // soft notes louder, for an even response
+)
+
+// velCurve sets how strongly VelExp and VelLog bend the response.
+const velCurve = 4
+
+// NewVelocity returns a Velocity that maps its "vel" input, a velocity
+// from 0 to 1 such as that of a MidiVelocity, through the response curve
+// selected by its "curve" input to a level from 0 to 1, for scaling the
+// amplitude or modulation of a note.
+func NewVelocity() *Velocity {
+	v := &Velocity{}
+	v.inputs("vel", &v.vel, "curve", &v.curve)
+	return v
+}
+
+type Velocity struct {
+	sink
+	vel   Processor
+	curve source
+}
+
+func (v *Velocity) Process(s []Sample) {
+	v.vel.Process(s)
+	curve := v.curve.Process()
+	for i, x := range s {
+		if x < 0 {
+			x = 0
+		} else if x > 1 {
+			x = 1
+		}
+		switch AsInt(curve[i]) {
+		case VelExp:
+			x = Sample(math.Expm1(velCurve*float64(x)) / math.Expm1(velCurve))
+		case VelLog:
+			x = Sample(math.Log1p(float64(x)*math.Expm1(velCurve)) / velCurve)
+		}
+		s[i] = x
+	}
+}
+
+// NewVelMod returns a VelMod, which maps its "vel" input, a velocity from 0
+// to 1, through the curve selected by its "curve" input as a Velocity
+// does, and scales it for the common destinations of a note's velocity,
+// each by its own depth:
+//   - The VelMod itself outputs a gain for the note's amplitude, which
+//     is 1 at full velocity and falls by the "amp" depth (1 by default) at
+//     zero velocity.
+//   - Its Cutoff output rises from 0 by the "cutoff" depth, in the pitch
+//     domain (0.1 by default, an octave), for summing into a filter's
+//     cutoff so that harder notes are brighter.
+//   - Its Time output falls from 1 by the "time" depth (0.5 by default),
+//     for scaling an envelope's attack so that harder notes are sharper.
+//
+// As with a Seq, the VelMod must be added to the Engine as a Ticker.
+func NewVelMod() *VelMod {
+	v := &VelMod{vel: NewVelocity()}
+	v.inputs("vel", &v.vel.vel, "curve", &v.vel.curve, "amp", &v.amp, "cutoff", &v.cutoff, "time", &v.time)
+	v.setDefault("amp", 1)
+	v.setDefault("cutoff", 0.1)
+	v.setDefault("time", 0.5)
+	v.outputs(v, 3)
+	return v
+}
+
+type VelMod struct {
+	sink
+	multi
+	amp, cutoff, time source
+
+	vel *Velocity
+}
+
+func (v *VelMod) Cutoff() Processor {
+	return multiOutput{&v.multi, 1}
+}
+
+func (v *VelMod) Time() Processor {
+	return multiOutput{&v.multi, 2}
+}
+
+func (v *VelMod) Process(s []Sample) {
+	copy(s, v.output(0))
+}
+
+func (v *VelMod) process() {
+	amp, cutoff, time := v.bufs[0], v.bufs[1], v.bufs[2]
+	v.vel.Process(amp)
+	da, dc, dt := v.amp.Process(), v.cutoff.Process(), v.time.Process()
+	for i, x := range amp {
+		amp[i] = 1 - da[i]*(1-x)
+		cutoff[i] = dc[i] * x
+		time[i] = 1 - dt[i]*x
+	}
+}
+
+func NewPitchBend() *PitchBend {
+	initMidiOnce.Do(initMidi)
+	b := &PitchBend{}
+	b.inputs("range", &b.rng)
+	b.setDefault("range", 2)
+	return b
+}
+
+// PitchBend outputs the position of the MIDI pitch bend wheel as a pitch
+// offset, for adding to the pitch of an oscillator. The wheel bends the
+// pitch by up to its "range" input in semitones, 2 by default.
+type PitchBend struct {
+	sink
+	rng source
+
+	c control
+}
+
+func (b *PitchBend) Process(s []Sample) {
+	v := float64(atomic.LoadInt64(&midiBend))
+	if v > 0 {
+		v /= 8191
+	} else {
+		v /= 8192
+	}
+	b.c.process(s, v)
+	rng := b.rng.Process()
+	for i := range s {
+		s[i] *= rng[i] * semitone
+	}
+}
+
+// Reset restarts the smoothing of the wheel's position from 0.
+func (b *PitchBend) Reset() {
+	b.c = control{}
+}
+
+// NewModWheel returns a MidiControl that outputs the position of the MIDI
+// modulation wheel.
+func NewModWheel() *MidiControl {
+	return newMidiControl(&midiModWheel)
+}
+
+// NewAftertouch returns a MidiControl that outputs the MIDI channel
+// aftertouch, the pressure on the held keys.
+func NewAftertouch() *MidiControl {
+	return newMidiControl(&midiPressure)
+}
+
+func newMidiControl(v *int64) *MidiControl {
+	initMidiOnce.Do(initMidi)
+	return &MidiControl{v: v}
+}
+
+// MidiControl outputs a MIDI controller value from 0 to 1, smoothed.
+type MidiControl struct {
+	v *int64 // atomic
+	c control
+}
+
+func (m *MidiControl) Process(s []Sample) {
+	m.c.process(s, float64(atomic.LoadInt64(m.v))/127)
+}
+
+// Reset restarts the smoothing of the controller's value from 0.
+func (m *MidiControl) Reset() {
+	m.c = control{}
 }
@@ -0,0 +1,100 @@
+/*
+Copyright 2026 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package audio
+
+// NewModMatrix returns a ModMatrix, for routing modulation sources to the
+// inputs of other modules. It must be added to the Engine as a Ticker.
+func NewModMatrix() *ModMatrix {
+	return &ModMatrix{
+		dups:  make(map[Processor]*Dup),
+		dests: make(map[modKey]*modDest),
+	}
+}
+
+// ModMatrix routes modulation sources, such as LFOs, envelopes and MIDI
+// controls, to module inputs, each route through an Atten with its own
+// depth. A routed input outputs the signal it was connected to before
+// its first route, plus the sum of the routes to it. Each source is
+// rendered once per block however many routes it feeds.
+type ModMatrix struct {
+	dups  map[Processor]*Dup
+	dests map[modKey]*modDest
+}
+
+type modKey struct {
+	s     Sink
+	input string
+}
+
+// Route routes src to the named input of dst with the given depth, or
+// sets the depth of the route if it exists. Like Input, it must not be
+// called while the modules are being processed.
+func (m *ModMatrix) Route(src Processor, dst Sink, input string, depth Sample) {
+	k := modKey{dst, input}
+	d, ok := m.dests[k]
+	if !ok {
+		d = &modDest{base: Value(0), tmp: make([]Sample, nSamples)}
+		if in, ok := dst.(inputter); ok {
+			d.base = in.input(input)
+		}
+		m.dests[k] = d
+		dst.Input(input, d)
+	}
+	for _, r := range d.routes {
+		if r.src == src {
+			r.atten.Input("amount", Value(depth))
+			return
+		}
+	}
+	dup, ok := m.dups[src]
+	if !ok {
+		dup = NewDup(src)
+		m.dups[src] = dup
+	}
+	a := NewAtten()
+	a.Input("in", dup.Output())
+	a.Input("amount", Value(depth))
+	d.routes = append(d.routes, modRoute{src, a})
+}
+
+func (m *ModMatrix) Tick() {
+	for _, d := range m.dups {
+		d.Tick()
+	}
+}
+
+// modDest mixes the routes to an input of a ModMatrix.
+type modDest struct {
+	base   Processor
+	routes []modRoute
+	tmp    []Sample
+}
+
+type modRoute struct {
+	src   Processor
+	atten *Atten
+}
+
+func (d *modDest) Process(s []Sample) {
+	d.base.Process(s)
+	for _, r := range d.routes {
+		r.atten.Process(d.tmp)
+		for i, v := range d.tmp {
+			s[i] += v
+		}
+	}
+}
@@ -0,0 +1,151 @@
+/*
+Copyright 2026 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package audio
+
+import (
+	"math"
+	"sync/atomic"
+	"unsafe"
+)
+
+// NewParam returns a Param with the value v.
+func NewParam(v Sample) *Param {
+	p := &Param{v: v, events: make([]paramEvent, 0, paramEvents)}
+	p.store(v)
+	return p
+}
+
+// paramEvents is the number of pending changes a Param holds without
+// allocating on the audio thread.
+const paramEvents = 64
+
+// Param is a constant, like a Value, that may be changed safely while the
+// Engine is running, for controls driven from UI, MIDI or network
+// goroutines.
+//
+// Most of the package follows a simple threading model: modules are built
+// and connected by one goroutine, and once the Engine has started, their
+// methods, such as Input, may be called only while holding the Engine's
+// lock. A Param is the exception. Its Set and SetAt methods may be called
+// from any goroutine at any time, without the lock; they hand the change
+// to the audio thread through a lock-free queue, which Process drains at
+// the start of each block, so the audio thread never waits on a mutex.
+// Changes thus take effect at block boundaries, or at the sample given to
+// SetAt, for sample-accurate sequencing and MIDI timing.
+//
+// Unlike a Value, a Param has a schedule that each call of Process moves
+// on by a block, so it must have exactly one consumer. To feed several
+// inputs, connect them to the Outputs of a Dup of the Param.
+type Param struct {
+	cur   uint64         // atomic; bits of v, for Value; first for alignment
+	queue unsafe.Pointer // *paramNode; changes not yet seen by Process, newest first
+
+	// Owned by Process.
+	v      Sample
+	events []paramEvent // pending changes, in order
+}
+
+type paramEvent struct {
+	at int // offset in samples from the start of the next block
+	v  Sample
+}
+
+type paramNode struct {
+	e    paramEvent
+	next *paramNode
+}
+
+// Set sets the value from the start of the next block.
+func (p *Param) Set(v Sample) {
+	p.SetAt(0, v)
+}
+
+// SetAt sets the value from the sample offset samples into the next block
+// to be processed. Offsets beyond the block carry on into the blocks after
+// it. Changes scheduled for the same sample take effect in the order they
+// were made.
+func (p *Param) SetAt(offset int, v Sample) {
+	if offset < 0 {
+		offset = 0
+	}
+	n := &paramNode{e: paramEvent{offset, v}}
+	for {
+		n.next = (*paramNode)(atomic.LoadPointer(&p.queue))
+		if atomic.CompareAndSwapPointer(&p.queue, unsafe.Pointer(n.next), unsafe.Pointer(n)) {
+			return
+		}
+	}
+}
+
+// Value returns the current value, as of the end of the last block to be
+// processed.
+func (p *Param) Value() Sample {
+	return Sample(math.Float64frombits(atomic.LoadUint64(&p.cur)))
+}
+
+func (p *Param) store(v Sample) {
+	atomic.StoreUint64(&p.cur, math.Float64bits(float64(v)))
+}
+
+// drain moves the changes made since the last block into p.events.
+func (p *Param) drain() {
+	n := (*paramNode)(atomic.SwapPointer(&p.queue, nil))
+	// Reverse the queue, to take the changes in the order they were made.
+	var first *paramNode
+	for n != nil {
+		next := n.next
+		n.next, first = first, n
+		n = next
+	}
+	for n = first; n != nil; n = n.next {
+		i := len(p.events)
+		for i > 0 && p.events[i-1].at > n.e.at {
+			i--
+		}
+		p.events = append(p.events, paramEvent{})
+		copy(p.events[i+1:], p.events[i:])
+		p.events[i] = n.e
+	}
+}
+
+func (p *Param) Process(s []Sample) {
+	if atomic.LoadPointer(&p.queue) != nil {
+		p.drain()
+	}
+	i, n := 0, 0
+	for _, e := range p.events {
+		if e.at >= len(s) {
+			break
+		}
+		for ; i < e.at; i++ {
+			s[i] = p.v
+		}
+		p.v = e.v
+		n++
+	}
+	for ; i < len(s); i++ {
+		s[i] = p.v
+	}
+	rest := copy(p.events, p.events[n:])
+	p.events = p.events[:rest]
+	for j := range p.events {
+		p.events[j].at -= len(s)
+	}
+	if n > 0 {
+		p.store(p.v)
+	}
+}
@@ -19,14 +19,23 @@ package audio
 import (
 	"math"
 	"math/rand"
+	"strconv"
 
 	"github.com/nf/sigourney/fast"
 )
 
-func sampleToHz(s Sample) float64 {
+// SampleToHz returns the frequency in Hz of the pitch s, where pitches
+// are 0.1 per octave and 0 is 440Hz (A4).
+func SampleToHz(s Sample) float64 {
 	return 440 * fast.Exp2(float64(s)*10)
 }
 
+// HzToSample returns the pitch of the frequency hz. It is the inverse of
+// SampleToHz.
+func HzToSample(hz float64) Sample {
+	return Sample(math.Log2(hz/440) / 10)
+}
+
 func NewSquare() *Square {
 	o := &Square{}
 	o.inputs("pitch", &o.pitch, "syn", &o.syn)
@@ -38,32 +47,158 @@ type Square struct {
 	pitch Processor // 0.1/oct, 0 == 440Hz
 	syn   trigger
 
-	pos float64
+	pos   float64
+	phase float64 // start phase, in cycles
+	free  bool    // ignore syn
+	over  *oversampler
+}
+
+// SetPhase sets the phase, from 0 to 1 cycle, at which the oscillator
+// starts and to which its "syn" input resets it.
+func (o *Square) SetPhase(p float64) {
+	o.phase = p - math.Floor(p)
+	o.pos = o.phase * waveHz
+}
+
+// SetFree sets whether the oscillator is free-running. A free-running
+// oscillator ignores its "syn" input, so its phase carries on from note to
+// note.
+func (o *Square) SetFree(free bool) {
+	o.free = free
+}
+
+// SetOversample makes the oscillator run at n times the sample rate
+// internally, which reduces aliasing at the cost of n times the work.
+// Values of n below 2 turn oversampling off; otherwise n must be 2, 4 or
+// 8, as for NewOversample.
+func (o *Square) SetOversample(n int) {
+	o.over = nil
+	if n > 1 {
+		o.over = newOversampler(n)
+	}
 }
 
 func (o *Square) Process(s []Sample) {
 	o.pitch.Process(s)
 	t := o.syn.Process()
+	n, b := 1, s
+	if o.over != nil {
+		n, b = o.over.n, o.over.buffer(s)
+	}
 	p := o.pos
-	hz, lastS := sampleToHz(s[0]), s[0]
+	hz, lastS := SampleToHz(s[0]), s[0]
 	for i := range s {
-		if o.syn.isTrigger(t[i]) {
-			p = 0
+		if o.syn.isTrigger(t[i]) && !o.free {
+			p = o.phase * waveHz
 		}
 		if s[i] != lastS {
-			hz = sampleToHz(s[i])
+			hz = SampleToHz(s[i])
 		}
-		p += hz
-		if p > waveHz {
-			p -= waveHz
+		for j := i * n; j < i*n+n; j++ {
+			p += hz / float64(n)
+			if p > waveHz {
+				p -= waveHz
+			}
+			if p > waveHz/2 {
+				b[j] = -1
+			} else {
+				b[j] = 1
+			}
 		}
-		if p > waveHz/2 {
-			s[i] = -1
-		} else {
-			s[i] = 1
+	}
+	o.pos = p
+	if o.over != nil {
+		o.over.downsample(b, s)
+	}
+}
+
+// Reset returns the oscillator to its start phase.
+func (o *Square) Reset() {
+	o.pos = o.phase * waveHz
+	if o.over != nil {
+		o.over.reset()
+	}
+}
+
+func NewSaw() *Saw {
+	o := &Saw{}
+	o.inputs("pitch", &o.pitch, "syn", &o.syn)
+	return o
+}
+
+// Saw is a rising sawtooth oscillator.
+type Saw struct {
+	sink
+	pitch Processor // 0.1/oct, 0 == 440Hz
+	syn   trigger
+
+	pos   float64
+	phase float64 // start phase, in cycles
+	free  bool    // ignore syn
+	over  *oversampler
+}
+
+// SetPhase sets the phase, from 0 to 1 cycle, at which the oscillator
+// starts and to which its "syn" input resets it.
+func (o *Saw) SetPhase(p float64) {
+	o.phase = p - math.Floor(p)
+	o.pos = o.phase * waveHz
+}
+
+// SetFree sets whether the oscillator is free-running. A free-running
+// oscillator ignores its "syn" input, so its phase carries on from note to
+// note.
+func (o *Saw) SetFree(free bool) {
+	o.free = free
+}
+
+// SetOversample makes the oscillator run at n times the sample rate
+// internally, which reduces aliasing at the cost of n times the work.
+// Values of n below 2 turn oversampling off; otherwise n must be 2, 4 or
+// 8, as for NewOversample.
+func (o *Saw) SetOversample(n int) {
+	o.over = nil
+	if n > 1 {
+		o.over = newOversampler(n)
+	}
+}
+
+func (o *Saw) Process(s []Sample) {
+	o.pitch.Process(s)
+	t := o.syn.Process()
+	n, b := 1, s
+	if o.over != nil {
+		n, b = o.over.n, o.over.buffer(s)
+	}
+	p := o.pos
+	hz, lastS := SampleToHz(s[0]), s[0]
+	for i := range s {
+		if o.syn.isTrigger(t[i]) && !o.free {
+			p = o.phase * waveHz
+		}
+		if s[i] != lastS {
+			hz = SampleToHz(s[i])
+		}
+		for j := i * n; j < i*n+n; j++ {
+			p += hz / float64(n)
+			if p > waveHz {
+				p -= waveHz
+			}
+			b[j] = Sample(2*p/waveHz - 1)
 		}
 	}
 	o.pos = p
+	if o.over != nil {
+		o.over.downsample(b, s)
+	}
+}
+
+// Reset returns the oscillator to its start phase.
+func (o *Saw) Reset() {
+	o.pos = o.phase * waveHz
+	if o.over != nil {
+		o.over.reset()
+	}
 }
 
 func NewSin() *Sin {
@@ -77,20 +212,36 @@ type Sin struct {
 	pitch Processor // 0.1/oct, 0 == 440Hz
 	syn   trigger
 
-	pos float64
+	pos   float64
+	phase float64 // start phase, in cycles
+	free  bool    // ignore syn
+}
+
+// SetPhase sets the phase, from 0 to 1 cycle, at which the oscillator
+// starts and to which its "syn" input resets it.
+func (o *Sin) SetPhase(p float64) {
+	o.phase = p - math.Floor(p)
+	o.pos = o.phase
+}
+
+// SetFree sets whether the oscillator is free-running. A free-running
+// oscillator ignores its "syn" input, so its phase carries on from note to
+// note.
+func (o *Sin) SetFree(free bool) {
+	o.free = free
 }
 
 func (o *Sin) Process(s []Sample) {
 	o.pitch.Process(s)
 	t := o.syn.Process()
 	p := o.pos
-	hz, lastS := sampleToHz(s[0]), s[0]
+	hz, lastS := SampleToHz(s[0]), s[0]
 	for i := range s {
-		if o.syn.isTrigger(t[i]) {
-			p = 0
+		if o.syn.isTrigger(t[i]) && !o.free {
+			p = o.phase
 		}
 		if s[i] != lastS {
-			hz = sampleToHz(s[i])
+			hz = SampleToHz(s[i])
 		}
 		s[i] = Sample(fast.Sin(p * 2 * math.Pi))
 		p += hz / waveHz
@@ -101,6 +252,11 @@ func (o *Sin) Process(s []Sample) {
 	o.pos = p
 }
 
+// Reset returns the oscillator to its start phase.
+func (o *Sin) Reset() {
+	o.pos = o.phase
+}
+
 func NewMul() *Mul {
 	a := &Mul{}
 	a.inputs("a", &a.a, "b", &a.b)
@@ -141,8 +297,62 @@ func (s *Sum) Process(buf []Sample) {
 	}
 }
 
+// NewSumN returns a module that adds its n inputs, named "in0" to "inN-1".
+// It does the work of n-1 chained Sums with a single Process call. It
+// panics if n is less than 1.
+func NewSumN(n int) *SumN {
+	if n < 1 {
+		panic("sum must have at least one input")
+	}
+	s := &SumN{rest: make([]source, n-1)}
+	args := []interface{}{"in0", &s.first}
+	for i := range s.rest {
+		args = append(args, "in"+strconv.Itoa(i+1), &s.rest[i])
+	}
+	s.inputs(args...)
+	return s
+}
+
+type SumN struct {
+	sink
+	first Processor
+	rest  []source
+}
+
+func (s *SumN) Process(buf []Sample) {
+	s.first.Process(buf)
+	for i := range s.rest {
+		b := s.rest[i].Process()
+		for j := range buf {
+			buf[j] += b[j]
+		}
+	}
+}
+
+// NewEnv returns an attack-decay envelope generator whose output ranges
+// from 0 to 1. The "att" and "dec" inputs set the time, in tens of
+// seconds, that the attack takes to rise from 0 to 1 and the decay to fall
+// from 1 to 0; a time of 0 is instant.
+//
+// The envelope is either attacking or decaying. It starts attacking, from
+// whatever its level is, when
+//   - its "trig" input emits a trigger, or
+//   - its "gate" input is higher than its level.
+//
+// It stops attacking, and starts decaying, when
+//   - its level reaches 1, or
+//   - the gate falls, unless "trig" emits a trigger on the same sample.
+//
+// While decaying, the level falls towards the gate, so that a held gate
+// is a sustain level, and a gate of 0 a full release.
+//
+// So a trigger alone, with the gate unconnected, plays the whole attack
+// and decay, and a gate that falls mid-attack releases from the level it
+// reached, without first rising to 1. Retriggering a sounding envelope
+// restarts the attack from its current level, which avoids a click.
 func NewEnv() *Env {
 	e := &Env{}
+	e.eoc = newAux(e)
 	e.inputs("gate", &e.gate, "trig", &e.trig, "att", &e.att, "dec", &e.dec)
 	return e
 }
@@ -153,40 +363,68 @@ type Env struct {
 	trig     trigger
 	att, dec source
 
-	v      Sample
-	up     bool
-	wasLow bool
+	v        Sample
+	up       bool   // attacking
+	lastGate Sample // the previous gate sample
+
+	eoc *aux
+}
+
+// EOC returns an output that emits a trigger when the envelope completes
+// its decay, returning to 0.
+func (e *Env) EOC() Processor {
+	return triggerOutput{e.eoc}
 }
 
 func (e *Env) Process(s []Sample) {
 	e.gate.Process(s)
 	att, dec, t := e.att.Process(), e.dec.Process(), e.trig.Process()
-	v := e.v
-	for i := range s {
-		trigger := e.trig.isTrigger(t[i])
-		if !e.up {
-			if trigger || v < s[i] {
-				e.up = true
-			} else if v > s[i] {
-				if d := dec[i]; d > 0 {
-					v -= 1 / (d * waveHz * 10)
-				}
-			}
+	v, lastGate := e.v, e.lastGate
+	for i, g := range s {
+		last := v
+		switch {
+		case e.trig.isTrigger(t[i]):
+			e.up = true
+		case g < lastGate:
+			e.up = false
+		case !e.up && v < g:
+			e.up = true
 		}
+		lastGate = g
 		if e.up {
 			if a := att[i]; a > 0 {
 				v += 1 / (a * waveHz * 10)
+			} else {
+				v = 1
+			}
+		} else if v > g {
+			// Stop at the gate, so that the decay settles at
+			// the sustain level rather than overshooting and
+			// starting another attack.
+			if d := dec[i]; d > 0 && v-1/(d*waveHz*10) > g {
+				v -= 1 / (d * waveHz * 10)
+			} else {
+				v = g
 			}
 		}
-		if v > 1 {
+		if v >= 1 {
 			v = 1
 			e.up = false
 		} else if v < 0 {
 			v = 0
 		}
+		e.eoc.b[i] = 0
+		if last > 0 && v == 0 {
+			e.eoc.b[i] = 1
+		}
 		s[i] = v
 	}
-	e.v = v
+	e.v, e.lastGate = v, lastGate
+}
+
+// Reset returns the envelope to 0, ready for its next attack.
+func (e *Env) Reset() {
+	e.v, e.up, e.lastGate = 0, false, 0
 }
 
 func NewClip() *Clip {
@@ -211,6 +449,28 @@ func (c *Clip) Process(s []Sample) {
 	}
 }
 
+// NewSoftClip returns a saturator that smoothly limits its "in" input to
+// the range -1 to 1 along a tanh curve. Unlike Clip, it rounds off the
+// knee instead of cutting the signal off sharply, for musical saturation.
+// Use Clip for safety limiting, as it leaves signals below 1 untouched.
+func NewSoftClip() *SoftClip {
+	c := &SoftClip{}
+	c.inputs("in", &c.in)
+	return c
+}
+
+type SoftClip struct {
+	sink
+	in Processor
+}
+
+func (c *SoftClip) Process(s []Sample) {
+	c.in.Process(s)
+	for i, v := range s {
+		s[i] = Sample(math.Tanh(float64(v)))
+	}
+}
+
 type Value Sample
 
 func (v Value) Process(s []Sample) {
@@ -220,7 +480,7 @@ func (v Value) Process(s []Sample) {
 }
 
 func NewRand() *Rand {
-	r := &Rand{}
+	r := &Rand{rng: newRNG()}
 	r.inputs("min", &r.min, "max", &r.max, "trig", &r.trig)
 	return r
 }
@@ -231,24 +491,166 @@ type Rand struct {
 	max  source
 	trig trigger
 
+	rng  *rand.Rand
 	last Sample
 }
 
+// Seed seeds the generator used to choose each value.
+func (r *Rand) Seed(seed int64) {
+	r.rng.Seed(seed)
+}
+
 func (r *Rand) Process(s []Sample) {
 	r.min.Process(s)
 	max, t := r.max.Process(), r.trig.Process()
 	v := r.last
 	for i := range s {
 		if r.trig.isTrigger(t[i]) {
-			v = s[i] + Sample(rand.Float64())*(max[i]-s[i])
+			v = s[i] + Sample(r.rng.Float64())*(max[i]-s[i])
 		}
 		s[i] = v
 	}
 	r.last = v
 }
 
+// Reset returns the held value to 0. The random number generator carries
+// on from where it was; Seed restarts it.
+func (r *Rand) Reset() {
+	r.last = 0
+}
+
+// NewSHNoise returns a sample-and-hold noise source for stepped random
+// control signals. On each "trig" trigger it takes a new value, uniformly
+// distributed from "min" to "max" (-1 and 1 by default), and holds it
+// until the next. It is a Rand with more useful defaults.
+func NewSHNoise() *SHNoise {
+	n := &SHNoise{NewRand()}
+	n.setDefault("min", -1)
+	n.setDefault("max", 1)
+	return n
+}
+
+type SHNoise struct {
+	*Rand
+}
+
+// NewFeedback returns a Feedback, for patching a signal back into the
+// modules that produce it. The Feedback passes its "in" input through
+// unchanged, and its Return output provides the signal that passed
+// through. Return should be read only from within the loop, where the
+// signal is still being rendered; there it outputs the previous block,
+// so the loop has one block of delay.
+//
+// Every loop in a patch must pass through a Return. A module renders all
+// of its inputs before it writes its output, so an output patched
+// straight back into any input of the module that produces it, or of a
+// module feeding that one, is rendered recursively without end. This
+// holds for every module and input: it does not matter whether an input
+// is processed in place, like the "a" input of Sum or Mul, or into a
+// buffer of its own, like their "b" input. CheckLoops finds loops that
+// lack a Feedback.
+func NewFeedback() *Feedback {
+	f := &Feedback{}
+	f.ret = newAux(f)
+	f.inputs("in", &f.in)
+	return f
+}
+
+type Feedback struct {
+	sink
+	in Processor
+
+	ret *aux
+}
+
+func (f *Feedback) Return() Processor {
+	return f.ret
+}
+
+func (f *Feedback) Process(s []Sample) {
+	f.in.Process(s)
+	copy(f.ret.b, s)
+}
+
+// Reset silences the block held for the Return.
+func (f *Feedback) Reset() {
+	for i := range f.ret.b {
+		f.ret.b[i] = 0
+	}
+}
+
+// swapTime is the duration in seconds of a Swap's crossfade.
+const swapTime = 0.01
+
+// NewSwap returns a Swap that outputs its "in" input, for replacing part
+// of a running patch. Connecting "in" switches sources immediately;
+// SwapTo crossfades to the new source.
+func NewSwap() *Swap {
+	w := &Swap{buf: make([]Sample, nSamples), fade: 1}
+	w.inputs("in", &w.in)
+	return w
+}
+
+type Swap struct {
+	sink
+	in Processor
+
+	old  Processor // the source being faded out, if any
+	buf  []Sample
+	fade Sample // progress of the crossfade, from 0 to 1
+}
+
+// SwapTo crossfades from the current source to p over the next few
+// milliseconds, after which the old source is no longer processed. Like
+// connecting an input, it must be called with the Engine locked. During
+// a crossfade, it fades from the mix being played, which carries on
+// crossfading as it fades out.
+func (w *Swap) SwapTo(p Processor) {
+	if w.old == nil {
+		w.old = w.in
+	} else {
+		w.old = &Swap{in: w.in, old: w.old, buf: w.buf, fade: w.fade}
+		w.buf = make([]Sample, nSamples)
+	}
+	w.in = p
+	w.fade = 0
+}
+
+func (w *Swap) Process(s []Sample) {
+	w.in.Process(s)
+	if w.old == nil {
+		return
+	}
+	w.old.Process(w.buf)
+	f := w.fade
+	for i := range s {
+		if f < 1 {
+			f += 1 / (swapTime * waveHz)
+			if f > 1 {
+				f = 1
+			}
+		}
+		s[i] = w.buf[i] + (s[i]-w.buf[i])*f
+	}
+	w.fade = f
+	if f >= 1 {
+		w.old = nil
+	}
+}
+
+// Reset finishes any crossfade at once, dropping the old source.
+func (w *Swap) Reset() {
+	w.old, w.fade = nil, 1
+}
+
+// NewDup returns a Dup that feeds the output of src to any number of
+// consumers, rendering it once per block however many there are. Each
+// Output's Process method fills the caller's buffer with a private copy of
+// the block, which the caller may modify freely; only inputs that promise
+// not to modify their samples, such as the "b" input of Sum, read the
+// Dup's buffer itself. A Dup must be ticked once per block.
 func NewDup(src Processor) *Dup {
-	d := &Dup{src: src}
+	d := &Dup{src: src, buf: make([]Sample, nSamples)}
 	return d
 }
 
@@ -267,12 +669,11 @@ func (d *Dup) SetSource(p Processor) {
 	d.src = p
 }
 
+// Output returns a new output of the Dup. It may be added at any time,
+// even part way through a block.
 func (d *Dup) Output() *Output {
 	o := &Output{d: d}
 	d.outs = append(d.outs, o)
-	if len(d.outs) > 1 && d.buf == nil {
-		d.buf = make([]Sample, nSamples)
-	}
 	return o
 }
 
@@ -280,19 +681,23 @@ type Output struct {
 	d *Dup
 }
 
+// Process copies the block into p, panicking if p is not BlockSize samples
+// long rather than copying part of it.
 func (o *Output) Process(p []Sample) {
-	if len(o.d.outs) == 1 {
-		if !o.d.done {
-			o.d.done = true
-			o.d.src.Process(p)
-		}
-		return
+	if err := checkBlock(p); err != nil {
+		panic(err)
 	}
+	copy(p, o.shared())
+}
+
+// shared returns the buffer shared by the outputs of the Dup, rendering
+// the source into it once per block. It must not be modified.
+func (o *Output) shared() []Sample {
 	if !o.d.done {
 		o.d.done = true
 		o.d.src.Process(o.d.buf)
 	}
-	copy(p, o.d.buf)
+	return o.d.buf
 }
 
 func (o *Output) Close() {
@@ -305,3 +710,701 @@ func (o *Output) Close() {
 		}
 	}
 }
+
+// NewLFO returns a low frequency sine oscillator, with output in the range
+// -1 to 1, whose frequency is set in Hz by its "rate" input.
+//
+// Once its "clock" input has emitted two triggers, the LFO instead follows
+// the tempo of the clock, taken as one trigger per quarter note. Its "div"
+// input sets the length of a cycle as a fraction of a whole note, such as
+// 1/4 (the default) for a cycle per beat, 1/8 for two, or 1/12 for eighth
+// note triplets. The rate is measured afresh from each clock, so the LFO
+// follows changes in tempo without jumps in its phase.
+//
+// A "reset" trigger restarts the cycle from phase 0. Connecting the
+// ResetOut of a Clock to the LFOs and sequencers it drives lines their
+// cycles up with the start of the pattern.
+func NewLFO() *LFO {
+	o := &LFO{}
+	o.inputs("rate", &o.rate, "clock", &o.clock, "div", &o.div, "reset", &o.reset)
+	o.setDefault("div", 0.25)
+	return o
+}
+
+type LFO struct {
+	sink
+	rate         Processor // Hz
+	clock, reset trigger
+	div          source
+
+	pos float64
+
+	clocked bool // whether the clock has pulsed
+	since   int  // samples since the last clock
+	period  int  // samples between the last two clocks
+}
+
+func (o *LFO) Process(s []Sample) {
+	o.rate.Process(s)
+	clock, div, reset := o.clock.Process(), o.div.Process(), o.reset.Process()
+	p := o.pos
+	for i := range s {
+		if o.reset.isTrigger(reset[i]) {
+			// A reset also restarts the clock, so the interval
+			// across it isn't taken as a change of tempo.
+			p, o.clocked = 0, false
+		}
+		if o.clock.isTrigger(clock[i]) {
+			if o.clocked {
+				o.period = o.since
+			}
+			o.clocked, o.since = true, 0
+		}
+		o.since++
+		hz := float64(s[i])
+		if d := float64(div[i]); o.period > 0 && d > 0 {
+			hz = waveHz / (float64(o.period) * 4 * d)
+		}
+		s[i] = Sample(fast.Sin(p * 2 * math.Pi))
+		p += hz / waveHz
+		if p >= 1 || p < 0 {
+			p -= math.Floor(p)
+		}
+	}
+	o.pos = p
+}
+
+// Reset returns the LFO to the start of its cycle and forgets the tempo of
+// its clock.
+func (o *LFO) Reset() {
+	o.pos = 0
+	o.clocked, o.since, o.period = false, 0, 0
+}
+
+// NewTremolo returns an amplitude modulator that scales its "in" input by
+// an internal LFO running at "rate" Hz. At a "depth" of 0 the input passes
+// unchanged; at 1 the gain sweeps fully between 0 and 1.
+func NewTremolo() *Tremolo {
+	t := &Tremolo{lfo: NewLFO(), mod: make([]Sample, nSamples)}
+	t.inputs("in", &t.in, "rate", &t.lfo.rate, "depth", &t.depth)
+	return t
+}
+
+type Tremolo struct {
+	sink
+	in    Processor
+	depth source
+
+	lfo *LFO
+	mod []Sample
+}
+
+func (t *Tremolo) Process(s []Sample) {
+	t.in.Process(s)
+	t.lfo.Process(t.mod)
+	depth := t.depth.Process()
+	for i := range s {
+		s[i] *= 1 - depth[i]*(1-t.mod[i])/2
+	}
+}
+
+func (t *Tremolo) Reset() {
+	t.lfo.Reset()
+}
+
+// semitone is the size of a semitone in the pitch domain.
+const semitone = 0.1 / 12
+
+// NewVibrato returns a pitch modulator that adds an internal LFO, running
+// at "rate" Hz, to the pitch at its "in" input. The "depth" input sets the
+// peak deviation in semitones. After each "trig" the vibrato fades in over
+// "delay" seconds, like a player easing into a held note.
+func NewVibrato() *Vibrato {
+	v := &Vibrato{lfo: NewLFO(), mod: make([]Sample, nSamples), ramp: 1}
+	v.inputs("in", &v.in, "rate", &v.lfo.rate, "depth", &v.depth, "delay", &v.delay, "trig", &v.trig)
+	return v
+}
+
+type Vibrato struct {
+	sink
+	in           Processor // 0.1/oct, 0 == 440Hz
+	depth, delay source
+	trig         trigger
+
+	lfo  *LFO
+	mod  []Sample
+	ramp Sample
+}
+
+func (v *Vibrato) Process(s []Sample) {
+	v.in.Process(s)
+	v.lfo.Process(v.mod)
+	depth, delay, t := v.depth.Process(), v.delay.Process(), v.trig.Process()
+	r := v.ramp
+	for i := range s {
+		if v.trig.isTrigger(t[i]) {
+			r = 0
+		}
+		if r < 1 {
+			if d := delay[i]; d > 0 {
+				r += 1 / (d * waveHz)
+			} else {
+				r = 1
+			}
+			if r > 1 {
+				r = 1
+			}
+		}
+		s[i] += v.mod[i] * depth[i] * semitone * r
+	}
+	v.ramp = r
+}
+
+func (v *Vibrato) Reset() {
+	v.lfo.Reset()
+	v.ramp = 1
+}
+
+// NewWalk returns a random walk that, on each "trig" trigger, moves its
+// output up or down by a random amount no greater than "step", bounded to
+// the range "lo" to "hi".
+func NewWalk() *Walk {
+	w := &Walk{rng: newRNG()}
+	w.inputs("trig", &w.trig, "step", &w.step, "lo", &w.lo, "hi", &w.hi)
+	return w
+}
+
+type Walk struct {
+	sink
+	trig         trigger
+	step, lo, hi source
+
+	rng *rand.Rand
+	v   Sample
+}
+
+// Seed seeds the generator used to choose each step.
+func (w *Walk) Seed(seed int64) {
+	w.rng.Seed(seed)
+}
+
+func (w *Walk) Process(s []Sample) {
+	t, step, lo, hi := w.trig.Process(), w.step.Process(), w.lo.Process(), w.hi.Process()
+	v := w.v
+	for i := range s {
+		if w.trig.isTrigger(t[i]) {
+			v += Sample(w.rng.Float64()*2-1) * step[i]
+			if v > hi[i] {
+				v = hi[i]
+			}
+			if v < lo[i] {
+				v = lo[i]
+			}
+		}
+		s[i] = v
+	}
+	w.v = v
+}
+
+// Reset returns the walk to 0. As for Rand, the random number generator
+// is not reseeded.
+func (w *Walk) Reset() {
+	w.v = 0
+}
+
+// NewAbs returns a full-wave rectifier that outputs the absolute value of
+// its "in" input.
+func NewAbs() *Abs {
+	a := &Abs{}
+	a.inputs("in", &a.in)
+	return a
+}
+
+type Abs struct {
+	sink
+	in Processor
+}
+
+func (a *Abs) Process(s []Sample) {
+	a.in.Process(s)
+	for i, v := range s {
+		if v < 0 {
+			s[i] = -v
+		}
+	}
+}
+
+// RectifyMode selects which half of the input a Rectify passes.
+type RectifyMode int
+
+const (
+	RectifyPositive RectifyMode = iota // pass positive samples only
+	RectifyNegative                    // pass negative samples only
+)
+
+// NewRectify returns a half-wave rectifier that passes one half of its
+// "in" input, as selected by mode, and outputs 0 for the other.
+func NewRectify(mode RectifyMode) *Rectify {
+	r := &Rectify{mode: mode}
+	r.inputs("in", &r.in)
+	return r
+}
+
+type Rectify struct {
+	sink
+	in Processor
+
+	mode RectifyMode
+}
+
+func (r *Rectify) Process(s []Sample) {
+	r.in.Process(s)
+	if r.mode == RectifyNegative {
+		for i, v := range s {
+			if v > 0 {
+				s[i] = 0
+			}
+		}
+		return
+	}
+	for i, v := range s {
+		if v < 0 {
+			s[i] = 0
+		}
+	}
+}
+
+// NewInvert returns a module that negates its "in" input while its "when"
+// gate is high. The gate is high unless connected, so by default the input
+// is always inverted.
+func NewInvert() *Invert {
+	v := &Invert{}
+	v.inputs("in", &v.in, "when", &v.when)
+	v.setDefault("when", 1)
+	return v
+}
+
+type Invert struct {
+	sink
+	in   Processor
+	when source
+}
+
+func (v *Invert) Process(s []Sample) {
+	v.in.Process(s)
+	when := v.when.Process()
+	for i := range s {
+		if when[i] > TriggerThreshold {
+			s[i] = -s[i]
+		}
+	}
+}
+
+// Chord types, for the "type" input of a Chord.
+const (
+	ChordMajor = iota
+	ChordMinor
+	ChordDom7
+	ChordMaj7
+	ChordMin7
+	ChordDim
+	ChordAug
+	ChordSus2
+	ChordSus4
+)
+
+// chordNotes holds the intervals in semitones above the root of the notes
+// of each chord type. Triads repeat the root an octave up.
+var chordNotes = [...][chordSize]int{
+	ChordMajor: {0, 4, 7, 12},
+	ChordMinor: {0, 3, 7, 12},
+	ChordDom7:  {0, 4, 7, 10},
+	ChordMaj7:  {0, 4, 7, 11},
+	ChordMin7:  {0, 3, 7, 10},
+	ChordDim:   {0, 3, 6, 12},
+	ChordAug:   {0, 4, 8, 12},
+	ChordSus2:  {0, 2, 7, 12},
+	ChordSus4:  {0, 5, 7, 12},
+}
+
+const chordSize = 4
+
+// NewChord returns a Chord that outputs the pitches of the notes of a
+// chord built on its "root" pitch input. The "type" input selects the
+// chord by its index, such as ChordMajor or ChordMin7. The Chord itself
+// outputs the root; Note provides each of the chord's notes. The Chord
+// must be added to the Engine as a Ticker.
+func NewChord() *Chord {
+	c := &Chord{}
+	c.inputs("root", &c.root, "type", &c.typ)
+	c.outputs(c, chordSize)
+	return c
+}
+
+type Chord struct {
+	sink
+	multi
+	root source // 0.1/oct, 0 == 440Hz
+	typ  source
+}
+
+// Note returns the pitch of the chord's ith note, from 0 (the root) to 3.
+// It panics if i is out of range.
+func (c *Chord) Note(i int) Processor {
+	if i < 0 || i >= chordSize {
+		panic("bad chord note: " + strconv.Itoa(i))
+	}
+	return multiOutput{&c.multi, i}
+}
+
+func (c *Chord) Process(s []Sample) {
+	copy(s, c.output(0))
+}
+
+func (c *Chord) process() {
+	root, typ := c.root.Process(), c.typ.Process()
+	for i := range root {
+		t := AsInt(typ[i])
+		if t < 0 || t >= len(chordNotes) {
+			t = ChordMajor
+		}
+		for n, b := range c.bufs {
+			b[i] = root[i] + Sample(chordNotes[t][n])*semitone
+		}
+	}
+}
+
+// NewMux returns a multiplexer with n inputs, named "in0" to "inN-1", that
+// outputs the input selected by its "sel" input, from 0 to n-1. A
+// fractional selection crossfades between the two adjacent inputs. Only
+// the inputs selected during a block are processed. It panics if n is
+// less than 1.
+func NewMux(n int) *Mux {
+	if n < 1 {
+		panic("mux must have at least one input")
+	}
+	m := &Mux{in: make([]source, n)}
+	args := []interface{}{"sel", &m.sel}
+	for i := range m.in {
+		args = append(args, "in"+strconv.Itoa(i), &m.in[i])
+	}
+	m.inputs(args...)
+	m.bufs = make([][]Sample, n)
+	return m
+}
+
+type Mux struct {
+	sink
+	sel Processor
+	in  []source
+
+	bufs [][]Sample
+}
+
+func (m *Mux) Process(s []Sample) {
+	m.sel.Process(s)
+	n := len(m.in)
+	lo, hi := n-1, 0
+	for i, v := range s {
+		if v < 0 {
+			s[i] = 0
+		} else if v > Sample(n-1) {
+			s[i] = Sample(n - 1)
+		}
+		a := int(s[i])
+		if a < lo {
+			lo = a
+		}
+		if b := int(math.Ceil(float64(s[i]))); b > hi {
+			hi = b
+		}
+	}
+	for i := lo; i <= hi; i++ {
+		m.bufs[i] = m.in[i].Process()
+	}
+	for i, v := range s {
+		a := int(v)
+		f := v - Sample(a)
+		out := m.bufs[a][i]
+		if f > 0 {
+			out += (m.bufs[a+1][i] - out) * f
+		}
+		s[i] = out
+	}
+}
+
+// Slew modes, for the "mode" input of a Slew.
+const (
+	SlewLag  = iota // move a fixed fraction of the way each sample
+	SlewTime        // glide in a straight line, taking "time" for any jump
+	SlewRate        // glide in a straight line, at an octave per "time"
+)
+
+// NewSlew returns a Slew that follows its "in" input smoothly. It is a
+// portamento for pitch, or a lag for control signals. The "mode" input
+// selects how it moves, given its "time" input in seconds:
+//   - SlewLag, the default, moves a fixed fraction of the way toward the
+//     input each sample, covering about two thirds of any jump in "time".
+//   - SlewTime glides at a constant speed that reaches the input after
+//     "time" whatever the size of the jump.
+//   - SlewRate glides at a constant speed of 0.1, an octave of pitch, per
+//     "time", so that larger jumps take longer.
+func NewSlew() *Slew {
+	l := &Slew{}
+	l.inputs("in", &l.in, "time", &l.time, "mode", &l.mode)
+	return l
+}
+
+type Slew struct {
+	sink
+	in         Processor
+	time, mode source
+
+	slew   slew
+	target Sample  // the input the SlewTime glide is heading for
+	step   float64 // the distance the SlewTime glide moves each sample
+}
+
+func (l *Slew) Process(s []Sample) {
+	l.in.Process(s)
+	time, mode := l.time.Process(), l.mode.Process()
+	for i, x := range s {
+		switch AsInt(mode[i]) {
+		case SlewTime:
+			if x != l.target {
+				l.target = x
+				l.step = math.Abs(float64(x)-l.slew.v) / (float64(time[i]) * waveHz)
+			}
+			s[i] = l.slew.glide(x, l.step)
+		case SlewRate:
+			s[i] = l.slew.glide(x, 0.1/(float64(time[i])*waveHz))
+		default:
+			s[i] = l.slew.next(x, time[i])
+		}
+	}
+}
+
+// Reset returns the Slew to 0.
+func (l *Slew) Reset() {
+	l.slew.v, l.target, l.step = 0, 0, 0
+}
+
+// slew is a one-pole lag with its coefficient cached for its time.
+type slew struct {
+	v    float64
+	time Sample
+	k    float64
+}
+
+// next moves the lag toward x with the time constant t and returns its
+// value.
+func (l *slew) next(x, t Sample) Sample {
+	if t != l.time {
+		l.time, l.k = t, coef(float64(t))
+	}
+	l.v = float64(x) + l.k*(l.v-float64(x))
+	return Sample(l.v)
+}
+
+// glide moves the lag toward x by step and returns its value. A step that
+// is not positive and finite jumps to x.
+func (l *slew) glide(x Sample, step float64) Sample {
+	d := float64(x) - l.v
+	if math.Abs(d) <= step || !(step > 0) || math.IsInf(step, 1) {
+		l.v = float64(x)
+	} else if d > 0 {
+		l.v += step
+	} else {
+		l.v -= step
+	}
+	return Sample(l.v)
+}
+
+// cent is a hundredth of a semitone in the pitch domain.
+const cent = semitone / 100
+
+// NewFineTune returns a FineTune that offsets the pitch at its "in" input
+// by "cents" hundredths of a semitone, for detuning oscillators against
+// each other.
+func NewFineTune() *FineTune {
+	f := &FineTune{}
+	f.inputs("in", &f.in, "cents", &f.cents)
+	return f
+}
+
+type FineTune struct {
+	sink
+	in    Processor // 0.1/oct, 0 == 440Hz
+	cents source
+}
+
+func (f *FineTune) Process(s []Sample) {
+	f.in.Process(s)
+	cents := f.cents.Process()
+	for i := range s {
+		s[i] += cents[i] * cent
+	}
+}
+
+// NewAtten returns an attenuverter, which scales its "in" input by its
+// "amount" input, 1 by default. Amounts between -1 and 1 attenuate, and
+// negative amounts invert.
+func NewAtten() *Atten {
+	a := &Atten{}
+	a.inputs("in", &a.in, "amount", &a.amount)
+	a.setDefault("amount", 1)
+	return a
+}
+
+type Atten struct {
+	sink
+	in     Processor
+	amount source
+}
+
+func (a *Atten) Process(s []Sample) {
+	a.in.Process(s)
+	amount := a.amount.Process()
+	for i := range s {
+		s[i] *= amount[i]
+	}
+}
+
+// NewKeyTrack returns a module that scales its "pitch" input by its
+// "amount" input, 1 by default, for summing into the cutoff of a filter so
+// that its cutoff follows the notes played. At an amount of 1 the cutoff
+// rises by an octave for each octave the pitch rises, and at 0.5 by half
+// an octave. The pitch 0 (440Hz) leaves the cutoff unchanged.
+func NewKeyTrack() *KeyTrack {
+	k := &KeyTrack{}
+	k.inputs("pitch", &k.in, "amount", &k.amount)
+	k.setDefault("amount", 1)
+	return k
+}
+
+// KeyTrack is an Atten whose "in" input is named "pitch".
+type KeyTrack struct {
+	Atten
+}
+
+// NewWetDry returns a module that mixes the output of fx with the dry
+// signal. It connects the "in" input of fx to its own "in" input, and
+// crossfades from the dry input to the output of fx as its "mix" input
+// goes from 0 to 1, so effects needn't each provide their own mix.
+func NewWetDry(fx interface {
+	Processor
+	Sink
+}) *WetDry {
+	w := &WetDry{
+		fx:  fx,
+		dry: make([]Sample, nSamples),
+	}
+	w.inputs("in", &w.in, "mix", &w.mix)
+	w.setDefault("mix", 0.5)
+	fx.Input("in", &w.feed)
+	return w
+}
+
+type WetDry struct {
+	sink
+	in  Processor
+	mix source
+
+	fx   Processor
+	feed bufferFeed
+	dry  []Sample
+}
+
+func (w *WetDry) Process(s []Sample) {
+	w.in.Process(w.dry)
+	w.feed.b = w.dry
+	w.fx.Process(s)
+	mix := w.mix.Process()
+	for i, v := range s {
+		s[i] = w.dry[i]*(1-mix[i]) + v*mix[i]
+	}
+}
+
+// NewImpulse returns a test signal that is 0 except for a single sample of
+// 1 on each "trig" trigger, for measuring the impulse responses of filters
+// and delays.
+func NewImpulse() *Impulse {
+	m := &Impulse{}
+	m.inputs("trig", &m.trig)
+	return m
+}
+
+type Impulse struct {
+	sink
+	trig trigger
+}
+
+func (m *Impulse) triggers() {}
+
+func (m *Impulse) Process(s []Sample) {
+	t := m.trig.Process()
+	for i := range s {
+		s[i] = 0
+		if m.trig.isTrigger(t[i]) {
+			s[i] = 1
+		}
+	}
+}
+
+// NewUnitStep returns a test signal that is 0 until the first "trig"
+// trigger and 1 from then on, for measuring step responses.
+func NewUnitStep() *UnitStep {
+	m := &UnitStep{}
+	m.inputs("trig", &m.trig)
+	return m
+}
+
+type UnitStep struct {
+	sink
+	trig trigger
+
+	high bool
+}
+
+func (m *UnitStep) Process(s []Sample) {
+	t := m.trig.Process()
+	for i := range s {
+		if m.trig.isTrigger(t[i]) {
+			m.high = true
+		}
+		s[i] = 0
+		if m.high {
+			s[i] = 1
+		}
+	}
+}
+
+func (m *UnitStep) Reset() {
+	m.high = false
+}
+
+// NewZ1 returns a unit delay, which delays its "in" input by one sample.
+func NewZ1() *Z1 {
+	z := &Z1{}
+	z.inputs("in", &z.in)
+	return z
+}
+
+type Z1 struct {
+	sink
+	in Processor
+
+	last Sample // the last sample of the previous block
+}
+
+func (z *Z1) Process(s []Sample) {
+	z.in.Process(s)
+	last := s[len(s)-1]
+	copy(s[1:], s)
+	s[0] = z.last
+	z.last = last
+}
+
+func (z *Z1) Reset() {
+	z.last = 0
+}
@@ -0,0 +1,152 @@
+/*
+Copyright 2026 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package audio
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// NewProfiler returns a Profiler, with timing off.
+func NewProfiler() *Profiler {
+	return &Profiler{}
+}
+
+// A Profiler accounts the time spent in the modules of a patch, for
+// finding its expensive parts. Modules are profiled by wrapping them with
+// the Profiler's Profile method. The timings of a patch are kept by its
+// own Profiler, so each Engine's patch should have its own; a discarded
+// patch is forgotten along with its Profiler, or its modules may be
+// removed from the Profiler one by one.
+type Profiler struct {
+	on int32 // atomic; whether the modules are timed
+
+	mu   sync.Mutex
+	mods []*Profiled
+
+	// parent is the innermost Profiled module being processed. It is
+	// only accessed from the audio thread.
+	parent *Profiled
+}
+
+// SetEnabled turns timing on or off. It is off by default, when a
+// Profiled module costs only a check of this setting.
+func (pr *Profiler) SetEnabled(on bool) {
+	var v int32
+	if on {
+		v = 1
+	}
+	atomic.StoreInt32(&pr.on, v)
+}
+
+// Profile returns a Processor that renders p, and while timing is on,
+// accounts the time spent in p's Process method to the given name.
+// Time spent in modules of the same Profiler nested within p is accounted
+// to them and not to p.
+func (pr *Profiler) Profile(name string, p Processor) *Profiled {
+	f := &Profiled{pr: pr, name: name, p: p}
+	pr.mu.Lock()
+	pr.mods = append(pr.mods, f)
+	pr.mu.Unlock()
+	return f
+}
+
+// Remove stops accounting f, dropping it from the Profiler's reports.
+func (pr *Profiler) Remove(f *Profiled) {
+	pr.mu.Lock()
+	defer pr.mu.Unlock()
+	for i, g := range pr.mods {
+		if g == f {
+			pr.mods = append(pr.mods[:i], pr.mods[i+1:]...)
+			break
+		}
+	}
+}
+
+type Profiled struct {
+	pr    *Profiler
+	name  string
+	p     Processor
+	total int64 // atomic; nanoseconds spent in p, excluding nested Profiled modules
+	child time.Duration
+}
+
+func (f *Profiled) node() Processor { return f.p }
+
+func (f *Profiled) Process(s []Sample) {
+	pr := f.pr
+	if atomic.LoadInt32(&pr.on) == 0 {
+		f.p.Process(s)
+		return
+	}
+	parent := pr.parent
+	pr.parent = f
+	f.child = 0
+	start := now()
+	f.p.Process(s)
+	d := now().Sub(start)
+	pr.parent = parent
+	if parent != nil {
+		parent.child += d
+	}
+	atomic.AddInt64(&f.total, int64(d-f.child))
+}
+
+// Profile is the time accounted to a Profiled module.
+type Profile struct {
+	Name    string
+	Total   time.Duration
+	Percent float64 // of the time accounted to all the Profiler's modules
+}
+
+// Report returns the time accounted to each of the Profiler's modules,
+// most expensive first.
+func (pr *Profiler) Report() []Profile {
+	pr.mu.Lock()
+	defer pr.mu.Unlock()
+	var ps []Profile
+	var sum time.Duration
+	for _, f := range pr.mods {
+		d := time.Duration(atomic.LoadInt64(&f.total))
+		ps = append(ps, Profile{Name: f.name, Total: d})
+		sum += d
+	}
+	if sum > 0 {
+		for i := range ps {
+			ps[i].Percent = 100 * float64(ps[i].Total) / float64(sum)
+		}
+	}
+	sort.Sort(byTotal(ps))
+	return ps
+}
+
+// Reset discards the time accounted to the Profiler's modules.
+func (pr *Profiler) Reset() {
+	pr.mu.Lock()
+	defer pr.mu.Unlock()
+	for _, f := range pr.mods {
+		atomic.StoreInt64(&f.total, 0)
+	}
+}
+
+type byTotal []Profile
+
+func (p byTotal) Len() int           { return len(p) }
+func (p byTotal) Less(i, j int) bool { return p[i].Total > p[j].Total }
+func (p byTotal) Swap(i, j int)      { p[i], p[j] = p[j], p[i] }
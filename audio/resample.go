@@ -0,0 +1,261 @@
+/*
+Copyright 2026 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package audio
+
+import (
+	"fmt"
+	"math"
+)
+
+// resampleWidth is the number of zero crossings on each side of the
+// windowed-sinc interpolation kernel.
+const resampleWidth = 16
+
+// Resample converts in to a new sample rate using windowed-sinc
+// interpolation. The ratio is the new sample rate divided by the old one,
+// so the result has len(in)*ratio samples. It panics if ratio is not
+// positive and finite.
+func Resample(in []Sample, ratio float64) []Sample {
+	checkRatio(ratio)
+	out := make([]Sample, int(float64(len(in))*ratio))
+	fc := math.Min(1, ratio)
+	for i := range out {
+		out[i] = interpolate(in, float64(i)/ratio, fc)
+	}
+	return out
+}
+
+func checkRatio(ratio float64) {
+	if !(ratio > 0) || math.IsInf(ratio, 1) {
+		panic(fmt.Sprintf("bad resample ratio %v", ratio))
+	}
+}
+
+// interpolate returns the value of in at the fractional position t,
+// band-limited to fc times its Nyquist frequency. Samples outside in are
+// taken to be zero.
+func interpolate(in []Sample, t, fc float64) Sample {
+	w := resampleWidth / fc
+	lo, hi := int(math.Floor(t-w))+1, int(math.Floor(t+w))
+	if lo < 0 {
+		lo = 0
+	}
+	if hi >= len(in) {
+		hi = len(in) - 1
+	}
+	var sum float64
+	for k := lo; k <= hi; k++ {
+		x := t - float64(k)
+		sum += float64(in[k]) * fc * sinc(fc*x) * hann(x/w)
+	}
+	return Sample(sum)
+}
+
+func sinc(x float64) float64 {
+	if x == 0 {
+		return 1
+	}
+	x *= math.Pi
+	return math.Sin(x) / x
+}
+
+// hann is the Hann window, spanning -1 to 1.
+func hann(x float64) float64 {
+	return 0.5 + 0.5*math.Cos(math.Pi*x)
+}
+
+// NewResample returns a streaming sample rate converter that treats its
+// "in" input as running at waveHz divided by ratio. It renders as many
+// blocks from its input as it needs to produce each block of output,
+// so the input is processed more or less often than the rest of the graph.
+// Like Resample, it panics if ratio is not positive and finite.
+func NewResample(ratio float64) *Resampler {
+	checkRatio(ratio)
+	fc := math.Min(1, ratio)
+	r := &Resampler{
+		ratio: ratio,
+		fc:    fc,
+		hist:  make([]Sample, 0, int(2*resampleWidth/fc)+int(nSamples/ratio)+2*nSamples),
+	}
+	r.inputs("in", &r.in)
+	return r
+}
+
+type Resampler struct {
+	sink
+	in source
+
+	ratio, fc float64
+	hist      []Sample // input samples around the current position
+	t         float64  // position in hist of the next output sample
+}
+
+func (r *Resampler) Process(s []Sample) {
+	w := resampleWidth / r.fc
+	for i := range s {
+		for len(r.hist) <= int(math.Floor(r.t+w)) {
+			r.hist = append(r.hist, r.in.Process()...)
+		}
+		s[i] = interpolate(r.hist, r.t, r.fc)
+		r.t += 1 / r.ratio
+	}
+	// Discard the input that has passed out of the kernel.
+	if n := int(math.Floor(r.t-w)) + 1; n > 0 {
+		m := copy(r.hist, r.hist[n:])
+		r.hist = r.hist[:m]
+		r.t -= float64(n)
+	}
+}
+
+// Reset discards the buffered input.
+func (r *Resampler) Reset() {
+	r.hist, r.t = r.hist[:0], 0
+}
+
+// oversampleWidth is the number of zero crossings of the original sample
+// rate on each side of the kernel used by oversampler.
+const oversampleWidth = 8
+
+// oversampler converts between the sample rate of the graph and n times
+// that rate. Both directions filter with the same low-pass kernel, cut off
+// just below the Nyquist frequency of the graph.
+type oversampler struct {
+	n       int
+	h       []float64
+	in, out []Sample // history for downsample and upsample
+	buf     []Sample
+}
+
+func newOversampler(n int) *oversampler {
+	if n != 2 && n != 4 && n != 8 {
+		panic("oversampling factor must be 2, 4 or 8")
+	}
+	fc := 0.9 / float64(n)
+	w := oversampleWidth * n
+	h := make([]float64, 2*w+1)
+	for k := range h {
+		x := float64(k - w)
+		h[k] = fc * sinc(fc*x) * hann(x/float64(w))
+	}
+	// The histories have room for a block more, which downsample and
+	// upsample append before filtering.
+	return &oversampler{
+		n:   n,
+		h:   h,
+		in:  make([]Sample, len(h)-1, len(h)-1+n*nSamples),
+		out: make([]Sample, len(h)/n+1, len(h)/n+1+nSamples),
+		buf: make([]Sample, n*nSamples),
+	}
+}
+
+// buffer returns a buffer of n times len(s) samples, valid until the next
+// call to buffer. The block s holds at most BlockSize samples.
+func (o *oversampler) buffer(s []Sample) []Sample {
+	return o.buf[:len(s)*o.n]
+}
+
+// reset clears the filters' history.
+func (o *oversampler) reset() {
+	for i := range o.in {
+		o.in[i] = 0
+	}
+	for i := range o.out {
+		o.out[i] = 0
+	}
+}
+
+// downsample filters in, which runs at n times the rate, and writes every
+// nth sample to s.
+func (o *oversampler) downsample(in, s []Sample) {
+	o.in = append(o.in, in...)
+	m := len(o.h) - 1
+	for i := range s {
+		x := o.in[i*o.n+o.n-1:]
+		var sum float64
+		for k, h := range o.h {
+			sum += h * float64(x[m-k])
+		}
+		s[i] = Sample(sum)
+	}
+	n := copy(o.in, o.in[len(in):])
+	o.in = o.in[:n]
+}
+
+// upsample writes s at n times the rate to out, which must hold n times
+// len(s) samples.
+func (o *oversampler) upsample(s, out []Sample) {
+	o.out = append(o.out, s...)
+	m := len(o.out) - len(s)
+	for i := range s {
+		x := o.out[:m+i+1]
+		for p := 0; p < o.n; p++ {
+			var sum float64
+			for k, j := p, len(x)-1; k < len(o.h); k, j = k+o.n, j-1 {
+				sum += o.h[k] * float64(x[j])
+			}
+			out[i*o.n+p] = Sample(sum * float64(o.n))
+		}
+	}
+	n := copy(o.out, o.out[len(s):])
+	o.out = o.out[:n]
+}
+
+// NewOversample returns a module that runs fx at n times the sample rate,
+// so that the harmonics a nonlinear fx generates above the Nyquist
+// frequency are filtered out instead of folding back as aliasing. It
+// connects the "in" input of fx to its own "in" input, upsampled. The fx
+// processes the upsampled signal a block at a time, n blocks for each of
+// the Oversample's, so its other inputs are also rendered n times a block
+// and should be constants such as Values.
+//
+// The factor n must be 2, 4 or 8, the rates the filter kernel is designed
+// for; NewOversample panics otherwise. Filtering delays the signal by
+// 2*oversampleWidth samples.
+func NewOversample(n int, fx interface {
+	Processor
+	Sink
+}) *Oversample {
+	o := &Oversample{fx: fx, over: newOversampler(n)}
+	o.inputs("in", &o.in)
+	fx.Input("in", &o.feed)
+	return o
+}
+
+type Oversample struct {
+	sink
+	in Processor
+
+	fx   Processor
+	feed bufferFeed
+	over *oversampler
+}
+
+func (o *Oversample) Process(s []Sample) {
+	o.in.Process(s)
+	b := o.over.buffer(s)
+	o.over.upsample(s, b)
+	for i := 0; i < len(b); i += len(s) {
+		c := b[i : i+len(s)]
+		o.feed.b = c
+		o.fx.Process(c)
+	}
+	o.over.downsample(b, s)
+}
+
+func (o *Oversample) Reset() {
+	o.over.reset()
+}
@@ -0,0 +1,158 @@
+/*
+Copyright 2026 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package audio
+
+// The delay lengths, in samples, of the comb and allpass filters of
+// Reverb, after Jezar's Freeverb. The right channel's filters are longer
+// by reverbSpread samples, which decorrelates the channels.
+var (
+	reverbCombs     = []int{1116, 1188, 1277, 1356, 1422, 1491, 1557, 1617}
+	reverbAllpasses = []int{556, 441, 341, 225}
+)
+
+const (
+	reverbSpread = 23
+	reverbGain   = 0.015 // input gain, which keeps the sum of the combs in range
+)
+
+// NewReverb returns a stereo algorithmic reverb. The mono sum of its "in"
+// input is fed to a bank of damped comb filters and then a chain of
+// allpass filters for each channel, whose delays differ slightly between
+// the channels to give a wide space. The "size" input, from 0 to 1, sets
+// the length of the tail and "damp", from 0 to 1, how quickly its high
+// frequencies decay. The "mix" input sets the balance of the reverb
+// against the dry signal, from 0 (dry) to 1 (wet).
+func NewReverb() *Reverb {
+	r := &Reverb{
+		l:   newReverbChannel(0),
+		r:   newReverbChannel(reverbSpread),
+		tmp: make([]Sample, nSamples),
+	}
+	r.inputs("in", &r.in, "size", &r.size, "damp", &r.damp, "mix", &r.mix)
+	r.setDefault("size", 0.5)
+	r.setDefault("damp", 0.5)
+	r.setDefault("mix", 0.3)
+	return r
+}
+
+type Reverb struct {
+	sink
+	in              stereoSource
+	size, damp, mix source
+
+	l, r *reverbChannel
+	tmp  []Sample
+}
+
+func (r *Reverb) ProcessStereo(l, rr []Sample) {
+	inL, inR := r.in.Process()
+	size, damp, mix := r.size.Process(), r.damp.Process(), r.mix.Process()
+	for i := range l {
+		x := (inL[i] + inR[i]) / 2
+		fb := size[i]*0.28 + 0.7
+		d := damp[i] * 0.4
+		wl := r.l.next(x*reverbGain, fb, d)
+		wr := r.r.next(x*reverbGain, fb, d)
+		dry := x * (1 - mix[i])
+		l[i], rr[i] = dry+wl*mix[i], dry+wr*mix[i]
+	}
+}
+
+func (r *Reverb) Process(s []Sample) {
+	processMono(r, s, r.tmp)
+}
+
+// Reset clears the reverb's tail.
+func (r *Reverb) Reset() {
+	r.l.reset()
+	r.r.reset()
+}
+
+// reverbChannel holds the filters of one channel of a Reverb.
+type reverbChannel struct {
+	combs     []reverbComb
+	allpasses []reverbAllpass
+}
+
+func newReverbChannel(spread int) *reverbChannel {
+	c := &reverbChannel{}
+	for _, n := range reverbCombs {
+		c.combs = append(c.combs, newReverbComb(n+spread))
+	}
+	for _, n := range reverbAllpasses {
+		c.allpasses = append(c.allpasses, newReverbAllpass(n+spread))
+	}
+	return c
+}
+
+func (c *reverbChannel) reset() {
+	for i := range c.combs {
+		c.combs[i].line.reset()
+		c.combs[i].lp = 0
+	}
+	for i := range c.allpasses {
+		c.allpasses[i].line.reset()
+	}
+}
+
+// next returns the channel's next output for the input x, given the
+// feedback fb and damping d of its combs.
+func (c *reverbChannel) next(x, fb, d Sample) Sample {
+	var y Sample
+	for i := range c.combs {
+		y += c.combs[i].next(x, fb, d)
+	}
+	for i := range c.allpasses {
+		y = c.allpasses[i].next(y)
+	}
+	return y
+}
+
+// reverbComb is a feedback comb filter with a one-pole lowpass filter in
+// its feedback path.
+type reverbComb struct {
+	line *delayLine
+	n    int    // length of the delay, in samples
+	lp   Sample // state of the lowpass filter
+}
+
+func newReverbComb(n int) reverbComb {
+	return reverbComb{line: newDelayLine(n - 1), n: n}
+}
+
+func (c *reverbComb) next(x, fb, d Sample) Sample {
+	y := c.line.Read(c.n - 1) // written n samples ago
+	c.lp = y*(1-d) + c.lp*d
+	c.line.Write(x + c.lp*fb)
+	return y
+}
+
+// reverbAllpass is a Schroeder allpass filter with a gain of 0.5.
+type reverbAllpass struct {
+	line *delayLine
+	n    int // length of the delay, in samples
+}
+
+func newReverbAllpass(n int) reverbAllpass {
+	return reverbAllpass{line: newDelayLine(n - 1), n: n}
+}
+
+func (a *reverbAllpass) next(x Sample) Sample {
+	b := a.line.Read(a.n - 1)
+	a.line.Write(x + b*0.5)
+	return b - x
+}
@@ -0,0 +1,244 @@
+/*
+Copyright 2026 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package audio
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+)
+
+// ReadWAV reads a WAV file of 16-bit integer or 32-bit floating point PCM
+// and returns its samples, mixed down to mono and resampled to the
+// Engine's sample rate.
+func ReadWAV(r io.Reader) ([]Sample, error) {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(b) < 12 || string(b[:4]) != "RIFF" || string(b[8:12]) != "WAVE" {
+		return nil, errors.New("not a WAV file")
+	}
+	var (
+		format, channels, bits uint16
+		rate                   uint32
+		data                   []byte
+	)
+	for b = b[12:]; len(b) >= 8; {
+		id, n := string(b[:4]), int(binary.LittleEndian.Uint32(b[4:8]))
+		b = b[8:]
+		if n > len(b) {
+			n = len(b)
+		}
+		switch id {
+		case "fmt ":
+			if n < 16 {
+				return nil, errors.New("short WAV format chunk")
+			}
+			format = binary.LittleEndian.Uint16(b)
+			channels = binary.LittleEndian.Uint16(b[2:])
+			rate = binary.LittleEndian.Uint32(b[4:])
+			bits = binary.LittleEndian.Uint16(b[14:])
+		case "data":
+			data = b[:n]
+		}
+		// Chunks are padded to an even length, but the pad byte of
+		// the last chunk, or the chunk itself, may be cut short.
+		if n+n%2 > len(b) {
+			break
+		}
+		b = b[n+n%2:]
+	}
+	switch {
+	case channels == 0 || rate == 0:
+		return nil, errors.New("WAV file has no format chunk")
+	case format == 1 && bits == 16, format == 3 && bits == 32:
+	default:
+		return nil, fmt.Errorf("unsupported WAV format %d with %d bits", format, bits)
+	}
+	size := int(bits/8) * int(channels)
+	s := make([]Sample, len(data)/size)
+	for i := range s {
+		var sum Sample
+		for c := 0; c < int(channels); c++ {
+			frame := data[i*size+c*int(bits/8):]
+			if format == 1 {
+				sum += Sample(int16(binary.LittleEndian.Uint16(frame))) / waveAmp
+			} else {
+				sum += Sample(math.Float32frombits(binary.LittleEndian.Uint32(frame)))
+			}
+		}
+		s[i] = sum / Sample(channels)
+	}
+	if rate != waveHz {
+		s = Resample(s, waveHz/float64(rate))
+	}
+	return s, nil
+}
+
+// LoadSample reads a WAV file with ReadWAV and, if peak is greater than
+// zero, normalizes it to that peak level with Normalize, so that samples
+// recorded at different levels play at the same level. With a peak of
+// zero the samples are left as they were recorded.
+func LoadSample(r io.Reader, peak Sample) ([]Sample, error) {
+	s, err := ReadWAV(r)
+	if err != nil || peak <= 0 {
+		return s, err
+	}
+	return Normalize(s, peak), nil
+}
+
+// Normalize returns a copy of s scaled so that its peak level is target.
+// Silence is returned unchanged.
+func Normalize(s []Sample, target Sample) []Sample {
+	out := make([]Sample, len(s))
+	p := peak(s)
+	if p == 0 {
+		copy(out, s)
+		return out
+	}
+	g := target / p
+	for i, v := range s {
+		out[i] = v * g
+	}
+	return out
+}
+
+// The playback modes of a Sampler, selected by its "mode" input.
+const (
+	SampleOneShot  = iota // play forwards once
+	SampleReverse         // play backwards once
+	SampleLoop            // play forwards, looping
+	SamplePingPong        // play forwards and backwards in turn, looping
+)
+
+// NewSampler returns a sample player that plays s on each "trig" trigger,
+// in the way selected by its "mode" input when triggered; see
+// SampleOneShot and the other modes. The "start" and "end" inputs select
+// the region of s to play, as fractions of its length, 0 and 1 by
+// default. They may fall between samples, which are then interpolated
+// linearly, and may be moved while a loop plays.
+func NewSampler(s []Sample) *Sampler {
+	p := &Sampler{s: s}
+	p.inputs("trig", &p.trig, "mode", &p.mode, "start", &p.start, "end", &p.end)
+	p.setDefault("end", 1)
+	return p
+}
+
+type Sampler struct {
+	sink
+	trig             trigger
+	mode, start, end source
+
+	s       []Sample
+	xfade   int // length of the loop crossfade, in samples
+	playing bool
+	loop    int     // mode, if the current playback loops
+	pos     float64 // position in s of the next sample
+	dir     float64 // direction of playback: 1 or -1
+}
+
+// SetCrossfade makes the SampleLoop mode crossfade the last n samples of
+// the loop into its first n, so that a loop whose ends don't match doesn't
+// click at the seam. Playback carries on from the end of the crossfade,
+// which shortens the loop by n samples. The crossfade is limited to half
+// the loop, and 0, the default, turns it off, as does a negative n.
+func (p *Sampler) SetCrossfade(n int) {
+	if n < 0 {
+		n = 0
+	}
+	p.xfade = n
+}
+
+func (p *Sampler) Process(s []Sample) {
+	t, mode := p.trig.Process(), p.mode.Process()
+	start, end := p.start.Process(), p.end.Process()
+	n := float64(len(p.s))
+	for i := range s {
+		a, b := float64(start[i])*n, float64(end[i])*n
+		if a < 0 {
+			a = 0
+		}
+		if b > n {
+			b = n
+		}
+		if p.trig.isTrigger(t[i]) {
+			p.playing, p.loop = true, SampleOneShot
+			p.pos, p.dir = a, 1
+			switch m := AsInt(mode[i]); m {
+			case SampleReverse:
+				p.pos, p.dir = b-1, -1
+			case SampleLoop, SamplePingPong:
+				p.loop = m
+			}
+		}
+		s[i] = 0
+		if !p.playing || b-a < 1 {
+			continue
+		}
+		switch p.loop {
+		case SampleLoop:
+			x := math.Min(float64(p.xfade), (b-a)/2)
+			if p.pos >= b || p.pos < a {
+				// Start again after the crossfade, which
+				// has played the start of the loop.
+				l := b - a - x
+				p.pos = a + x + math.Mod(p.pos-b, l)
+				if p.pos < a {
+					p.pos += l
+				}
+			}
+			if f := (p.pos - (b - x)) / x; x > 0 && f >= 0 {
+				s[i] = p.at(p.pos)*Sample(1-f) + p.at(p.pos-b+x+a)*Sample(f)
+				p.pos += p.dir
+				continue
+			}
+		case SamplePingPong:
+			if last := b - 1; p.pos > last {
+				p.pos, p.dir = math.Max(a, 2*last-p.pos), -1
+			} else if p.pos < a {
+				p.pos, p.dir = math.Min(last, 2*a-p.pos), 1
+			}
+		default:
+			if p.pos >= b || p.pos < a {
+				p.playing = false
+				continue
+			}
+		}
+		s[i] = p.at(p.pos)
+		p.pos += p.dir
+	}
+}
+
+// Reset stops the Sampler playing.
+func (p *Sampler) Reset() {
+	p.playing = false
+}
+
+// at returns the sample at the position x, interpolating linearly.
+func (p *Sampler) at(x float64) Sample {
+	j := int(x)
+	f := Sample(x - float64(j))
+	v := p.s[j]
+	if f > 0 && j+1 < len(p.s) {
+		v += (p.s[j+1] - v) * f
+	}
+	return v
+}
@@ -0,0 +1,805 @@
+/*
+Copyright 2026 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package audio
+
+import (
+	"math"
+	"math/rand"
+	"sync/atomic"
+)
+
+// Step is a single step of a Seq.
+type Step struct {
+	Pitch Sample // 0.1/oct, 0 == 440Hz
+
+	// Prob is the chance that the step fires, from 0 to 1. The zero
+	// Step thus never fires: a step meant to play needs a Prob of 1.
+	Prob float64
+
+	// Ratchet is the number of triggers the step emits, evenly spaced
+	// across the step. Zero and one both mean a single trigger. The
+	// spacing comes from the time between the last two clocks, so the
+	// step played on the first clock after starting or a Reset emits a
+	// single trigger whatever its Ratchet.
+	Ratchet int
+
+	// Tie makes the step continue the note of the step before it, if
+	// that step fired: the Seq's gate is held across the two steps,
+	// and the tied step changes the pitch without emitting a trigger.
+	Tie bool
+}
+
+// NewSeq returns a step sequencer that advances one step on each "clock"
+// trigger. A "reset" trigger makes the next clock play the first step.
+// The Seq itself outputs a trigger for each step that fires; its Pitch
+// output holds the pitch of the most recently fired step, and its EOC
+// output emits a trigger each time the clock reaches the last step.
+//
+// Its Gate output goes high when a step fires and stays high for the
+// fraction of a step set by its "gatelen" input, 0.5 by default, or across
+// the whole step when the next step is tied to it. Untied steps thus make
+// distinct gate pulses, each retriggering an envelope, while tied steps
+// make a single long note, as for a legato bass line.
+func NewSeq(steps []Step) *Seq {
+	if len(steps) == 0 {
+		panic("no steps")
+	}
+	q := &Seq{
+		steps: steps,
+		step:  -1,
+		rng:   newRNG(),
+	}
+	q.inputs("clock", &q.clock, "reset", &q.reset, "gatelen", &q.gatelen)
+	q.setDefault("gatelen", 0.5)
+	q.outputs(q, 4)
+	return q
+}
+
+type Seq struct {
+	sink
+	multi
+	clock, reset trigger
+	gatelen      source
+
+	steps []Step
+	step  int
+	rng   *rand.Rand
+	pitch Sample
+
+	clocked bool
+	since   int // samples since the last clock
+	period  int // samples between the last two clocks
+
+	ratchet int // ratchet count of the current step
+	left    int // ratchet triggers remaining in the current step
+
+	fired, tied bool // whether the current step fired, and was tied
+	gateOn      bool
+	gateLeft    int  // samples until the gate closes, or -1 for the next clock
+	rise        bool // whether the gate opens on the next sample
+}
+
+// Seed seeds the generator used to roll against each step's probability.
+func (q *Seq) Seed(seed int64) {
+	q.rng.Seed(seed)
+}
+
+func (q *Seq) Pitch() Processor {
+	return multiOutput{&q.multi, 1}
+}
+
+func (q *Seq) EOC() Processor {
+	return triggerOutput{multiOutput{&q.multi, 2}}
+}
+
+// Gate returns the Seq's gate output.
+func (q *Seq) Gate() Processor {
+	return multiOutput{&q.multi, 3}
+}
+
+func (q *Seq) triggers() {}
+
+func (q *Seq) Process(s []Sample) {
+	copy(s, q.output(0))
+}
+
+func (q *Seq) process() {
+	trig, pitch, eoc, gate := q.bufs[0], q.bufs[1], q.bufs[2], q.bufs[3]
+	clock, reset, gatelen := q.clock.Process(), q.reset.Process(), q.gatelen.Process()
+	for i := range trig {
+		if q.reset.isTrigger(reset[i]) {
+			q.rewind()
+		}
+		c := q.clock.isTrigger(clock[i])
+		trig[i], eoc[i] = 0, 0
+		if q.next(c) {
+			trig[i] = 1
+		}
+		if c && q.last() {
+			eoc[i] = 1
+		}
+		pitch[i] = q.pitch
+		gate[i] = 0
+		if q.nextGate(c, gatelen[i]) {
+			gate[i] = 1
+		}
+	}
+}
+
+// nextGate advances the gate by one sample, after next, and reports
+// whether the gate is open.
+func (q *Seq) nextGate(clock bool, gatelen Sample) bool {
+	switch {
+	case clock && !q.fired:
+		q.gateOn, q.rise = false, false
+	case clock && q.tied:
+		q.gateLeft = q.gateLength(gatelen)
+	case clock:
+		// A gate held open until this clock closes for a sample, so
+		// that the step's gate is a new pulse.
+		q.rise = q.gateOn
+		q.gateOn = !q.rise
+		q.gateLeft = q.gateLength(gatelen)
+	case q.rise:
+		q.gateOn, q.rise = true, false
+	case q.gateOn && q.gateLeft > 0:
+		if q.gateLeft--; q.gateLeft == 0 {
+			q.gateOn = false
+		}
+	}
+	return q.gateOn
+}
+
+// gateLength returns the number of samples that the gate of the current
+// step stays open, or -1 if it stays open until the next clock: because the
+// next step is tied to it, or because the clock's tempo isn't yet known.
+// An untied gate closes at least a sample before the next step.
+func (q *Seq) gateLength(gatelen Sample) int {
+	if q.steps[(q.step+1)%len(q.steps)].Tie || q.period == 0 {
+		return -1
+	}
+	n := int(gatelen * Sample(q.period))
+	if n < 1 {
+		n = 1
+	} else if n > q.period-1 {
+		n = q.period - 1
+	}
+	return n
+}
+
+// rewind makes the next clock play the first step.
+func (q *Seq) rewind() {
+	q.step = -1
+	q.left = 0
+	q.gateOn, q.rise = false, false
+}
+
+// Reset returns the sequencer to its state when new: rewound, with its
+// gate closed, its pitch 0 and the tempo of its clock forgotten.
+func (q *Seq) Reset() {
+	q.rewind()
+	q.clocked, q.since, q.period = false, 0, 0
+	q.pitch, q.ratchet = 0, 0
+	q.fired, q.tied, q.gateLeft = false, false, 0
+}
+
+// last reports whether the current step is the final step of the pattern.
+func (q *Seq) last() bool {
+	return q.step == len(q.steps)-1
+}
+
+// next advances the sequencer by one sample, during which a clock trigger
+// may have arrived, and reports whether it emits a trigger.
+func (q *Seq) next(clock bool) bool {
+	q.since++
+	if clock {
+		if q.clocked {
+			q.period = q.since
+		}
+		q.clocked = true
+		q.since = 0
+		q.step = (q.step + 1) % len(q.steps)
+		st := q.steps[q.step]
+		q.left = 0
+		q.fired, q.tied = false, false
+		if q.rng.Float64() >= st.Prob {
+			return false
+		}
+		q.fired = true
+		q.pitch = st.Pitch
+		if st.Tie && q.gateOn {
+			q.tied = true
+			return false
+		}
+		if st.Ratchet > 1 && q.period > 0 {
+			q.ratchet = st.Ratchet
+			q.left = st.Ratchet - 1
+		}
+		return true
+	}
+	if q.left > 0 && q.since >= (q.ratchet-q.left)*q.period/q.ratchet {
+		q.left--
+		return true
+	}
+	return false
+}
+
+// Part is a section of a Song: a pattern and the number of times to play it.
+type Part struct {
+	Seq     *Seq
+	Repeats int
+}
+
+// NewSong returns a Song that plays each of the given parts in order,
+// looping back to the first part after the last. The Song forwards its
+// "clock" input to the Seq of the current part, ignoring that Seq's own
+// inputs, and moves on to the next part once the current pattern has
+// played through the part's number of repeats. A "reset" trigger returns
+// to the start of the first part. Like a Seq, the Song outputs triggers
+// and provides a Pitch output, and must be added to the Engine as a
+// Ticker.
+func NewSong(parts []Part) *Song {
+	if len(parts) == 0 {
+		panic("no parts")
+	}
+	g := &Song{parts: parts}
+	g.inputs("clock", &g.clock, "reset", &g.reset)
+	g.outputs(g, 2)
+	return g
+}
+
+type Song struct {
+	sink
+	multi
+	clock, reset trigger
+
+	parts []Part
+	part  int // index of the current part
+	plays int // completed plays of the current part's pattern
+	pitch Sample
+}
+
+func (g *Song) Pitch() Processor {
+	return multiOutput{&g.multi, 1}
+}
+
+func (g *Song) Process(s []Sample) {
+	copy(s, g.output(0))
+}
+
+// Seed seeds the Seq of each part with its own seed derived from seed.
+func (g *Song) Seed(seed int64) {
+	rng := rand.New(rand.NewSource(seed))
+	for _, p := range g.parts {
+		p.Seq.Seed(rng.Int63())
+	}
+}
+
+// Reset returns to the start of the first part and resets the Seq of
+// every part.
+func (g *Song) Reset() {
+	g.part, g.plays, g.pitch = 0, 0, 0
+	for _, p := range g.parts {
+		p.Seq.Reset()
+	}
+}
+
+func (g *Song) process() {
+	trig, pitch := g.bufs[0], g.bufs[1]
+	clock, reset := g.clock.Process(), g.reset.Process()
+	for i := range trig {
+		if g.reset.isTrigger(reset[i]) {
+			g.part, g.plays = 0, 0
+			g.parts[0].Seq.rewind()
+		}
+		q := g.parts[g.part].Seq
+		c := g.clock.isTrigger(clock[i])
+		if c && q.last() {
+			g.plays++
+			if g.plays >= g.parts[g.part].Repeats {
+				g.plays = 0
+				g.part = (g.part + 1) % len(g.parts)
+				next := g.parts[g.part].Seq
+				next.rewind()
+				// Carry over the clock timing so ratchets work
+				// from the first step of the new part.
+				next.clocked, next.since, next.period = q.clocked, q.since, q.period
+				q = next
+			}
+		}
+		trig[i] = 0
+		if q.next(c) {
+			trig[i] = 1
+			g.pitch = q.pitch
+		}
+		pitch[i] = g.pitch
+	}
+}
+
+// NewClock returns a clock that emits a trigger on each beat, at the tempo
+// given by its "bpm" input in beats per minute. The "swing" input delays
+// every other beat by lengthening the interval before it and shortening
+// the one after, so the tempo is unchanged. A swing of 0 is straight and
+// 0.5 gives a triplet feel.
+//
+// The clock runs while its "run" gate is high, as it is by default, and
+// pauses while it is low, resuming where it left off. A "reset" trigger
+// moves it back to the start of the pattern: it plays the first beat at
+// once, or as soon as it runs, and emits a trigger on its ResetOut
+// output, which may be connected to the "reset" inputs of the sequencers
+// and LFOs it drives to bring them back to the start of their patterns and
+// cycles too. Any number of inputs may share the ResetOut output.
+func NewClock() *Clock {
+	c := &Clock{}
+	c.rst = newAux(c)
+	c.inputs("bpm", &c.bpm, "swing", &c.swing, "run", &c.run, "reset", &c.reset)
+	c.setDefault("run", 1)
+	return c
+}
+
+type Clock struct {
+	sink
+	bpm, swing, run source
+	reset           trigger
+
+	next float64 // samples until the next beat
+	off  bool    // whether the next beat is an off-beat
+
+	rst *aux
+}
+
+// ResetOut returns an output that emits a trigger on each reset.
+func (c *Clock) ResetOut() Processor {
+	return triggerOutput{c.rst}
+}
+
+func (c *Clock) triggers() {}
+
+func (c *Clock) Process(s []Sample) {
+	bpm, swing := c.bpm.Process(), c.swing.Process()
+	run, reset := c.run.Process(), c.reset.Process()
+	for i := range s {
+		s[i], c.rst.b[i] = 0, 0
+		if c.reset.isTrigger(reset[i]) {
+			c.next, c.off = 0, false
+			c.rst.b[i] = 1
+		}
+		if bpm[i] <= 0 || run[i] <= TriggerThreshold {
+			continue
+		}
+		if c.next <= 0 {
+			s[i] = 1
+			sw := swing[i]
+			if sw < 0 {
+				sw = 0
+			} else if sw > 1 {
+				sw = 1
+			}
+			beat := waveHz * 60 / float64(bpm[i])
+			if c.off {
+				c.next += beat * float64(1-sw*2/3)
+			} else {
+				c.next += beat * float64(1+sw*2/3)
+			}
+			c.off = !c.off
+		}
+		c.next--
+	}
+}
+
+// Reset moves the clock back to its first beat.
+func (c *Clock) Reset() {
+	c.next, c.off = 0, false
+}
+
+// NewCounter returns a Counter that counts "trig" triggers, wrapping to
+// zero after "max"-1 and on each "reset" trigger. It outputs the raw
+// count; with a max of zero or less the count is never wrapped.
+func NewCounter() *Counter {
+	c := &Counter{}
+	c.inputs("trig", &c.trig, "reset", &c.reset, "max", &c.max)
+	return c
+}
+
+type Counter struct {
+	sink
+	trig, reset trigger
+	max         source
+
+	n    int
+	last int64 // atomic; the count at the end of the last block
+}
+
+// IntValue returns the count at the end of the most recently processed
+// block. It may be called concurrently with Process.
+func (c *Counter) IntValue() int {
+	return int(atomic.LoadInt64(&c.last))
+}
+
+func (c *Counter) Process(s []Sample) {
+	t, r, max := c.trig.Process(), c.reset.Process(), c.max.Process()
+	for i := range s {
+		if c.reset.isTrigger(r[i]) {
+			c.n = 0
+		}
+		if c.trig.isTrigger(t[i]) {
+			c.n++
+		}
+		if m := AsInt(max[i]); m > 0 && c.n >= m {
+			c.n %= m
+		}
+		s[i] = Sample(c.n)
+	}
+	atomic.StoreInt64(&c.last, int64(c.n))
+}
+
+// Reset returns the count to 0.
+func (c *Counter) Reset() {
+	c.n = 0
+	atomic.StoreInt64(&c.last, 0)
+}
+
+// NewBurst returns a Burst that, on each "trig" trigger, emits a burst of
+// "count" triggers spaced at "rate" triggers per second. A trigger that
+// arrives during a burst restarts it. Its EOC output makes it a
+// multi-output module, which must be added to the Engine as a Ticker.
+func NewBurst() *Burst {
+	b := &Burst{}
+	b.inputs("trig", &b.trig, "count", &b.count, "rate", &b.rate)
+	b.outputs(b, 2)
+	return b
+}
+
+type Burst struct {
+	sink
+	multi
+	trig        trigger
+	count, rate source
+
+	left int     // triggers remaining in the burst
+	next float64 // samples until the next trigger
+}
+
+// EOC returns an output that emits a trigger along with the last trigger
+// of each burst.
+func (b *Burst) EOC() Processor {
+	return triggerOutput{multiOutput{&b.multi, 1}}
+}
+
+func (b *Burst) triggers() {}
+
+func (b *Burst) Process(s []Sample) {
+	copy(s, b.output(0))
+}
+
+func (b *Burst) process() {
+	out, eoc := b.bufs[0], b.bufs[1]
+	t, count, rate := b.trig.Process(), b.count.Process(), b.rate.Process()
+	for i := range out {
+		if b.trig.isTrigger(t[i]) {
+			b.left = AsInt(count[i])
+			b.next = 0
+		}
+		out[i], eoc[i] = 0, 0
+		if b.left <= 0 {
+			continue
+		}
+		if b.next <= 0 {
+			out[i] = 1
+			b.left--
+			if b.left == 0 {
+				eoc[i] = 1
+			}
+			if r := rate[i]; r > 0 {
+				b.next += waveHz / float64(r)
+			} else {
+				b.left = 0
+			}
+		}
+		b.next--
+	}
+}
+
+// Reset ends any burst in progress.
+func (b *Burst) Reset() {
+	b.left, b.next = 0, 0
+}
+
+// NewLatch returns a Latch whose output goes to 1 on a "set" trigger and
+// to 0 on a "reset" trigger, holding its state in between. A "trig"
+// trigger toggles the output. If triggers coincide, reset takes precedence
+// over set, and set over toggle.
+func NewLatch() *Latch {
+	l := &Latch{}
+	l.inputs("set", &l.set, "reset", &l.reset, "trig", &l.trig)
+	return l
+}
+
+type Latch struct {
+	sink
+	set, reset, trig trigger
+
+	v Sample
+}
+
+func (l *Latch) Process(s []Sample) {
+	set, reset, t := l.set.Process(), l.reset.Process(), l.trig.Process()
+	v := l.v
+	for i := range s {
+		if l.trig.isTrigger(t[i]) {
+			v = 1 - v
+		}
+		if l.set.isTrigger(set[i]) {
+			v = 1
+		}
+		if l.reset.isTrigger(reset[i]) {
+			v = 0
+		}
+		s[i] = v
+	}
+	l.v = v
+}
+
+// Reset returns the output to 0.
+func (l *Latch) Reset() {
+	l.v = 0
+}
+
+// NewDebounce returns a filter that passes each "trig" trigger unless it
+// arrives within "time" seconds of the last trigger it passed.
+func NewDebounce() *Debounce {
+	d := &Debounce{}
+	d.inputs("trig", &d.trig, "time", &d.time)
+	return d
+}
+
+type Debounce struct {
+	sink
+	trig trigger
+	time source
+
+	cool float64 // samples until the next trigger may pass
+}
+
+func (d *Debounce) triggers() {}
+
+func (d *Debounce) Process(s []Sample) {
+	t, time := d.trig.Process(), d.time.Process()
+	for i := range s {
+		s[i] = 0
+		if d.trig.isTrigger(t[i]) && d.cool <= 0 {
+			s[i] = 1
+			d.cool = float64(time[i]) * waveHz
+		}
+		d.cool--
+	}
+}
+
+// Reset lets the next trigger pass.
+func (d *Debounce) Reset() {
+	d.cool = 0
+}
+
+const (
+	tapHistory   = 4    // intervals averaged by TapTempo
+	tapTimeout   = 2    // seconds after which TapTempo forgets earlier taps
+	tapTolerance = 0.25 // fraction by which an interval may differ from the average
+	tapDefault   = 120  // TapTempo output before it has been tapped
+)
+
+// NewTapTempo returns a TapTempo that outputs a tempo in beats per minute,
+// for a Clock's "bpm" input, set by tapping its "tap" input. The tempo is
+// the average of the last few intervals between taps, so it takes at
+// least two taps to set. An interval far from the average is ignored,
+// unless the next interval confirms it as a new tempo.
+func NewTapTempo() *TapTempo {
+	tt := &TapTempo{since: -1, bpm: tapDefault}
+	tt.inputs("tap", &tt.tap)
+	return tt
+}
+
+type TapTempo struct {
+	sink
+	tap trigger
+
+	since   int                 // samples since the last tap, or -1
+	hist    [tapHistory]float64 // recent intervals, in samples, a ring
+	n, next int                 // intervals in hist, and where the next goes
+	outlier float64             // an interval that did not match hist, or 0
+	bpm     Sample
+}
+
+func (tt *TapTempo) Process(s []Sample) {
+	t := tt.tap.Process()
+	for i := range s {
+		if tt.tap.isTrigger(t[i]) {
+			tt.tapped()
+		}
+		if tt.since >= 0 {
+			tt.since++
+		}
+		s[i] = tt.bpm
+	}
+}
+
+// Reset forgets the taps, returning the tempo to its default.
+func (tt *TapTempo) Reset() {
+	tt.since, tt.n, tt.next, tt.outlier = -1, 0, 0, 0
+	tt.bpm = tapDefault
+}
+
+func (tt *TapTempo) tapped() {
+	iv := float64(tt.since)
+	tt.since = 0
+	if iv < 0 || iv > tapTimeout*waveHz {
+		tt.n, tt.outlier = 0, 0
+		return
+	}
+	match := func(a, b float64) bool {
+		return math.Abs(a-b) <= b*tapTolerance
+	}
+	switch {
+	case tt.n == 0 || match(iv, tt.average()):
+		tt.add(iv)
+	case tt.outlier > 0 && match(iv, tt.outlier):
+		tt.n = 0
+		tt.add(tt.outlier)
+		tt.add(iv)
+	default:
+		tt.outlier = iv
+		return
+	}
+	tt.outlier = 0
+	tt.bpm = Sample(60 * waveHz / tt.average())
+}
+
+// add adds an interval to the history, replacing the oldest if full.
+func (tt *TapTempo) add(iv float64) {
+	tt.hist[tt.next] = iv
+	tt.next = (tt.next + 1) % tapHistory
+	if tt.n < tapHistory {
+		tt.n++
+	}
+}
+
+func (tt *TapTempo) average() float64 {
+	var sum float64
+	for i := 0; i < tt.n; i++ {
+		sum += tt.hist[(tt.next-1-i+tapHistory)%tapHistory]
+	}
+	return sum / float64(tt.n)
+}
+
+// NewQuantizeTrig returns a QuantizeTrig that aligns its "trig" triggers
+// to a grid set by its "clock" input, divided into "div" steps per clock
+// (1 by default). A trigger is delayed to the next step of the grid, or
+// passed at once if it falls in the first half of a step, as a trigger
+// played slightly late. Until the clock has pulsed twice, and while it is
+// slower than it was, the only steps are the clock pulses themselves.
+func NewQuantizeTrig() *QuantizeTrig {
+	q := &QuantizeTrig{}
+	q.inputs("trig", &q.trig, "clock", &q.clock, "div", &q.div)
+	q.setDefault("div", 1)
+	return q
+}
+
+type QuantizeTrig struct {
+	sink
+	trig, clock trigger
+	div         source
+
+	clocked bool // whether the clock has pulsed
+	since   int  // samples since the last clock
+	period  int  // samples between the last two clocks
+	step    int  // index of the last step of the grid
+	last    int  // value of since at the last step
+	pending bool // whether a trigger awaits the next step
+}
+
+func (q *QuantizeTrig) triggers() {}
+
+func (q *QuantizeTrig) Process(s []Sample) {
+	t, clock, div := q.trig.Process(), q.clock.Process(), q.div.Process()
+	for i := range s {
+		s[i] = 0
+		if q.clock.isTrigger(clock[i]) {
+			if q.clocked {
+				q.period = q.since
+			}
+			q.clocked, q.since, q.step = true, 0, -1
+		}
+		d := AsInt(div[i])
+		if d < 1 {
+			d = 1
+		}
+		g := 0
+		if q.period > 0 {
+			g = q.since * d / q.period
+		}
+		onGrid := q.clocked && g < d && g != q.step
+		if onGrid {
+			q.step, q.last = g, q.since
+		}
+		if q.trig.isTrigger(t[i]) {
+			if onGrid || q.period > 0 && (q.since-q.last)*d*2 < q.period {
+				s[i] = 1
+			} else {
+				q.pending = true
+			}
+		}
+		if onGrid && q.pending {
+			s[i] = 1
+			q.pending = false
+		}
+		q.since++
+	}
+}
+
+// Reset forgets the clock and any pending trigger.
+func (q *QuantizeTrig) Reset() {
+	q.clocked, q.since, q.period, q.step, q.last, q.pending = false, 0, 0, 0, 0, false
+}
+
+// NewClockMul returns a ClockMul that multiplies the rate of its "clock"
+// input by "mult" (1 by default). It passes each clock and fills the
+// interval after it with mult-1 more triggers, spaced evenly by the
+// interval between the last two clocks. A clock arriving early, as the
+// tempo rises, cuts the subdivisions short and restarts them.
+func NewClockMul() *ClockMul {
+	c := &ClockMul{}
+	c.inputs("clock", &c.clock, "mult", &c.mult)
+	c.setDefault("mult", 1)
+	return c
+}
+
+type ClockMul struct {
+	sink
+	clock trigger
+	mult  source
+
+	clocked bool // whether the clock has pulsed
+	since   int  // samples since the last clock
+	period  int  // samples between the last two clocks
+	count   int  // triggers since the last clock
+}
+
+func (c *ClockMul) triggers() {}
+
+func (c *ClockMul) Process(s []Sample) {
+	clock, mult := c.clock.Process(), c.mult.Process()
+	for i := range s {
+		s[i] = 0
+		m := AsInt(mult[i])
+		if c.clock.isTrigger(clock[i]) {
+			if c.clocked {
+				c.period = c.since
+			}
+			c.clocked, c.since, c.count = true, 0, 0
+		}
+		due := c.count == 0 || c.period > 0 && c.since*m >= c.count*c.period
+		if c.clocked && c.count < m && due {
+			s[i] = 1
+			c.count++
+		}
+		c.since++
+	}
+}
+
+// Reset forgets the clock.
+func (c *ClockMul) Reset() {
+	c.clocked, c.since, c.period, c.count = false, 0, 0, 0
+}
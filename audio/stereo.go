@@ -0,0 +1,438 @@
+/*
+Copyright 2026 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package audio
+
+import (
+	"math"
+
+	"github.com/nf/sigourney/fast"
+)
+
+// StereoProcessor is implemented by modules that produce a left and right
+// channel. Their Process method renders the mono sum, (L+R)/2, so that a
+// stereo module may be used anywhere a mono signal is expected.
+type StereoProcessor interface {
+	Processor
+	ProcessStereo(l, r []Sample)
+}
+
+// processMono renders the mono sum of p into s, using tmp as scratch space.
+func processMono(p StereoProcessor, s, tmp []Sample) {
+	p.ProcessStereo(s, tmp)
+	for i := range s {
+		s[i] = (s[i] + tmp[i]) / 2
+	}
+}
+
+// stereoSource is a stereo input. If its Processor is not a
+// StereoProcessor its mono output is used for both channels.
+type stereoSource struct {
+	p    Processor
+	sp   StereoProcessor // p, if it is one
+	l, r []Sample
+}
+
+// set connects the input to p. Whether p is stereo is decided here rather
+// than in Process, since a type assertion to an interface may allocate.
+func (s *stereoSource) set(p Processor) {
+	s.p = p
+	s.sp, _ = p.(StereoProcessor)
+}
+
+func (s *stereoSource) Process() (l, r []Sample) {
+	if s.sp != nil {
+		s.sp.ProcessStereo(s.l, s.r)
+	} else {
+		s.p.Process(s.l)
+		copy(s.r, s.l)
+	}
+	return s.l, s.r
+}
+
+// NewStereo returns a StereoProcessor that joins its "left" and "right"
+// inputs into a stereo pair.
+func NewStereo() *Stereo {
+	s := &Stereo{tmp: make([]Sample, nSamples)}
+	s.inputs("left", &s.left, "right", &s.right)
+	return s
+}
+
+type Stereo struct {
+	sink
+	left  Processor
+	right source
+
+	tmp []Sample
+}
+
+func (s *Stereo) ProcessStereo(l, r []Sample) {
+	s.left.Process(l)
+	copy(r, s.right.Process())
+}
+
+func (s *Stereo) Process(buf []Sample) {
+	processMono(s, buf, s.tmp)
+}
+
+// NewSplit returns a Split that provides the channels of p as separate
+// mono Processors. Like a StereoProcessor, the Split itself outputs the
+// mono sum. It must be added to the Engine as a Ticker.
+func NewSplit(p StereoProcessor) *Split {
+	s := &Split{p: p}
+	s.outputs(s, 2)
+	return s
+}
+
+type Split struct {
+	multi
+	p StereoProcessor
+}
+
+func (s *Split) process() {
+	s.p.ProcessStereo(s.bufs[0], s.bufs[1])
+}
+
+func (s *Split) Process(buf []Sample) {
+	l, r := s.output(0), s.output(1)
+	for i := range buf {
+		buf[i] = (l[i] + r[i]) / 2
+	}
+}
+
+func (s *Split) Left() Processor {
+	return multiOutput{&s.multi, 0}
+}
+
+func (s *Split) Right() Processor {
+	return multiOutput{&s.multi, 1}
+}
+
+// NewWidth returns a mid/side width control for the stereo pair at its
+// "in" input. The side signal, (L-R)/2, is scaled by the "width" input:
+// a width of 0 collapses the pair to mono, 1 leaves it unchanged, and
+// values above 1 exaggerate the stereo image.
+func NewWidth() *Width {
+	w := &Width{tmp: make([]Sample, nSamples)}
+	w.inputs("in", &w.in, "width", &w.width)
+	w.setDefault("width", 1)
+	return w
+}
+
+type Width struct {
+	sink
+	in    stereoSource
+	width source
+
+	tmp []Sample
+}
+
+func (w *Width) ProcessStereo(l, r []Sample) {
+	inL, inR := w.in.Process()
+	width := w.width.Process()
+	for i := range l {
+		m := (inL[i] + inR[i]) / 2
+		s := (inL[i] - inR[i]) / 2 * width[i]
+		l[i], r[i] = m+s, m-s
+	}
+}
+
+func (w *Width) Process(s []Sample) {
+	processMono(w, s, w.tmp)
+}
+
+// NewAutoPan returns a stereo balance control for the pair at its "in"
+// input, swept from side to side by an internal LFO running at "rate" Hz.
+// The "depth" input sets how far the balance moves; at 0 the input passes
+// unchanged and at 1 it sweeps fully from the left to the right channel.
+func NewAutoPan() *AutoPan {
+	a := &AutoPan{
+		lfo: NewLFO(),
+		mod: make([]Sample, nSamples),
+		tmp: make([]Sample, nSamples),
+	}
+	a.inputs("in", &a.in, "rate", &a.lfo.rate, "depth", &a.depth)
+	return a
+}
+
+type AutoPan struct {
+	sink
+	in    stereoSource
+	depth source
+
+	lfo      *LFO
+	mod, tmp []Sample
+}
+
+func (a *AutoPan) ProcessStereo(l, r []Sample) {
+	inL, inR := a.in.Process()
+	a.lfo.Process(a.mod)
+	depth := a.depth.Process()
+	for i := range l {
+		gl, gr := balance(depth[i] * a.mod[i])
+		l[i], r[i] = inL[i]*gl, inR[i]*gr
+	}
+}
+
+func (a *AutoPan) Reset() {
+	a.lfo.Reset()
+}
+
+func (a *AutoPan) Process(s []Sample) {
+	processMono(a, s, a.tmp)
+}
+
+// balance returns the channel gains for a balance position p, from -1
+// (left) to 1 (right). The channel opposite p is attenuated along a
+// quarter cosine; at 0 both gains are 1.
+func balance(p Sample) (l, r Sample) {
+	if p > 1 {
+		p = 1
+	} else if p < -1 {
+		p = -1
+	}
+	g := Sample(fast.Sin((1 - math.Abs(float64(p))) * math.Pi / 2))
+	if p > 0 {
+		return g, 1
+	}
+	return 1, g
+}
+
+// VCAMode selects how a VCA maps its control signal to gain.
+type VCAMode int
+
+const (
+	VCALinear VCAMode = iota // gain equals the control signal
+	VCAExp                   // control 0 to 1 sweeps the gain from -60dB to 0dB
+	VCAPower                 // gain is sin(control·π/2), for constant-power crossfades
+)
+
+// vcaRange is the range in decibels of a VCAExp sweep.
+const vcaRange = 60
+
+// NewVCA returns a voltage-controlled amplifier that scales its "in"
+// input, mono or stereo, by a gain derived from the sum of its "cv" and
+// "offset" inputs according to mode. In all modes a control signal of 0
+// or less mutes the input.
+func NewVCA(mode VCAMode) *VCA {
+	v := &VCA{mode: mode, tmp: make([]Sample, nSamples)}
+	v.inputs("in", &v.in, "cv", &v.cv, "offset", &v.offset)
+	return v
+}
+
+type VCA struct {
+	sink
+	in         stereoSource
+	cv, offset source
+
+	mode VCAMode
+	tmp  []Sample
+}
+
+func (v *VCA) gain(c Sample) Sample {
+	if c <= 0 {
+		return 0
+	}
+	switch v.mode {
+	case VCAExp:
+		if c > 1 {
+			c = 1
+		}
+		return Sample(fast.Exp2(float64(c-1) * vcaRange / 20 * math.Log2(10)))
+	case VCAPower:
+		if c > 1 {
+			c = 1
+		}
+		return Sample(fast.Sin(float64(c) * math.Pi / 2))
+	}
+	return c
+}
+
+func (v *VCA) ProcessStereo(l, r []Sample) {
+	inL, inR := v.in.Process()
+	cv, offset := v.cv.Process(), v.offset.Process()
+	for i := range l {
+		g := v.gain(cv[i] + offset[i])
+		l[i], r[i] = inL[i]*g, inR[i]*g
+	}
+}
+
+func (v *VCA) Process(s []Sample) {
+	processMono(v, s, v.tmp)
+}
+
+// haasMax is the longest delay, in seconds, supported by Haas.
+const haasMax = 0.05
+
+// haasLevel is the gain of the delayed channel of a Haas. Keeping it below
+// that of the direct channel makes the comb filtering in the mono sum
+// shallow, so the effect stays mono-compatible.
+const haasLevel = 0.7
+
+// NewHaas returns a stereo widener that plays its mono "in" input on the
+// left channel and, delayed by "delay" seconds (up to 50ms), on the right.
+// Delays of about 5 to 35ms are heard as width rather than as an echo.
+func NewHaas() *Haas {
+	h := &Haas{
+		line: newDelayLine(int(haasMax * waveHz)),
+		tmp:  make([]Sample, nSamples),
+	}
+	h.inputs("in", &h.in, "delay", &h.delay)
+	return h
+}
+
+type Haas struct {
+	sink
+	in    Processor
+	delay source
+
+	line *delayLine // past input
+	tmp  []Sample
+}
+
+func (h *Haas) ProcessStereo(l, r []Sample) {
+	h.in.Process(l)
+	delay := h.delay.Process()
+	for i, v := range l {
+		h.line.Write(v)
+		r[i] = h.line.ReadFrac(float64(delay[i])*waveHz) * haasLevel
+	}
+}
+
+// Reset clears the delay.
+func (h *Haas) Reset() {
+	h.line.reset()
+}
+
+func (h *Haas) Process(s []Sample) {
+	processMono(h, s, h.tmp)
+}
+
+// pingPongMax is the longest delay, in seconds, supported by PingPong.
+const pingPongMax = 2
+
+// NewPingPong returns a stereo delay whose echoes bounce between the
+// channels. The mono sum of its "in" input is delayed by "time" seconds
+// (up to 2) onto the left channel, and each echo is delayed again onto the
+// other channel, scaled by the feedback "fb". The "mix" input sets the
+// balance of the echoes against the dry signal, from 0 (dry) to 1 (wet).
+func NewPingPong() *PingPong {
+	n := int(pingPongMax * waveHz)
+	p := &PingPong{
+		lineL: newDelayLine(n),
+		lineR: newDelayLine(n),
+		tmp:   make([]Sample, nSamples),
+	}
+	p.inputs("in", &p.in, "time", &p.time, "fb", &p.fb, "mix", &p.mix)
+	p.setDefault("time", 0.25)
+	p.setDefault("fb", 0.5)
+	p.setDefault("mix", 0.5)
+	return p
+}
+
+type PingPong struct {
+	sink
+	in            stereoSource
+	time, fb, mix source
+
+	lineL, lineR *delayLine // the signals delayed onto each channel
+	tmp          []Sample
+}
+
+func (p *PingPong) ProcessStereo(l, r []Sample) {
+	inL, inR := p.in.Process()
+	time, fb, mix := p.time.Process(), p.fb.Process(), p.mix.Process()
+	for i := range l {
+		// The lines are read before this sample is written, so a
+		// delay of d samples is d-1 before the most recent.
+		d := float64(time[i])*waveHz - 1
+		if d < 0 {
+			d = 0
+		}
+		dl, dr := p.lineL.ReadFrac(d), p.lineR.ReadFrac(d)
+		x := (inL[i] + inR[i]) / 2
+		p.lineL.Write(x + fb[i]*dr)
+		p.lineR.Write(fb[i] * dl)
+		dry := x * (1 - mix[i])
+		l[i], r[i] = dry+dl*mix[i], dry+dr*mix[i]
+	}
+}
+
+// Reset clears the echoes.
+func (p *PingPong) Reset() {
+	p.lineL.reset()
+	p.lineR.reset()
+}
+
+func (p *PingPong) Process(s []Sample) {
+	processMono(p, s, p.tmp)
+}
+
+// NewStereoDelay returns a stereo delay whose channels echo independently:
+// each channel of its "in" input is delayed by its own time, "timeL" or
+// "timeR" seconds (up to 2), and each echo is fed back into the same
+// channel, scaled by the shared feedback "fb". Unequal times make echoes
+// that drift in and out of step across the stereo field. The "mix" input
+// sets the balance of the echoes against the dry signal, from 0 (dry) to
+// 1 (wet).
+func NewStereoDelay() *StereoDelay {
+	n := int(pingPongMax * waveHz)
+	d := &StereoDelay{
+		lineL: newDelayLine(n),
+		lineR: newDelayLine(n),
+		tmp:   make([]Sample, nSamples),
+	}
+	d.inputs("in", &d.in, "timeL", &d.timeL, "timeR", &d.timeR, "fb", &d.fb, "mix", &d.mix)
+	d.setDefault("timeL", 0.25)
+	d.setDefault("timeR", 0.375)
+	d.setDefault("fb", 0.5)
+	d.setDefault("mix", 0.5)
+	return d
+}
+
+type StereoDelay struct {
+	sink
+	in                    stereoSource
+	timeL, timeR, fb, mix source
+
+	lineL, lineR *delayLine
+	tmp          []Sample
+}
+
+func (d *StereoDelay) ProcessStereo(l, r []Sample) {
+	inL, inR := d.in.Process()
+	timeL, timeR := d.timeL.Process(), d.timeR.Process()
+	fb, mix := d.fb.Process(), d.mix.Process()
+	for i := range l {
+		// As in PingPong, the lines are read before they are written.
+		dl := d.lineL.ReadFrac(math.Max(float64(timeL[i])*waveHz-1, 0))
+		dr := d.lineR.ReadFrac(math.Max(float64(timeR[i])*waveHz-1, 0))
+		d.lineL.Write(inL[i] + fb[i]*dl)
+		d.lineR.Write(inR[i] + fb[i]*dr)
+		l[i] = inL[i]*(1-mix[i]) + dl*mix[i]
+		r[i] = inR[i]*(1-mix[i]) + dr*mix[i]
+	}
+}
+
+// Reset clears the echoes.
+func (d *StereoDelay) Reset() {
+	d.lineL.reset()
+	d.lineR.reset()
+}
+
+func (d *StereoDelay) Process(s []Sample) {
+	processMono(d, s, d.tmp)
+}
@@ -0,0 +1,101 @@
+/*
+Copyright 2026 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package audio
+
+import "math"
+
+// NewWavetable returns an oscillator that plays a cycle of one of tables
+// at the pitch of its "pitch" input. The tables may differ in length; each
+// holds a single cycle. The "morph" input, from 0 to 1, selects a table,
+// blending linearly between the two nearest, so that sweeping it through
+// tables of related waveforms changes the timbre smoothly. A "syn" trigger
+// restarts the cycle.
+func NewWavetable(tables [][]Sample) *Wavetable {
+	if len(tables) == 0 {
+		panic("no tables")
+	}
+	for _, t := range tables {
+		if len(t) == 0 {
+			panic("empty table")
+		}
+	}
+	o := &Wavetable{tables: tables}
+	o.inputs("pitch", &o.pitch, "syn", &o.syn, "morph", &o.morph)
+	return o
+}
+
+type Wavetable struct {
+	sink
+	pitch Processor // 0.1/oct, 0 == 440Hz
+	syn   trigger
+	morph source
+
+	tables [][]Sample
+	pos    float64 // phase, in cycles
+}
+
+func (o *Wavetable) Process(s []Sample) {
+	o.pitch.Process(s)
+	t, morph := o.syn.Process(), o.morph.Process()
+	p := o.pos
+	last := len(o.tables) - 1
+	hz, lastS := SampleToHz(s[0]), s[0]
+	for i := range s {
+		if o.syn.isTrigger(t[i]) {
+			p = 0
+		}
+		if s[i] != lastS {
+			hz, lastS = SampleToHz(s[i]), s[i]
+		}
+		m := float64(morph[i]) * float64(last)
+		if m < 0 {
+			m = 0
+		} else if m > float64(last) {
+			m = float64(last)
+		}
+		j := int(m)
+		v := lookup(o.tables[j], p)
+		if f := Sample(m - float64(j)); f > 0 {
+			v += (lookup(o.tables[j+1], p) - v) * f
+		}
+		s[i] = v
+		p += hz / waveHz
+		if p >= 1 || p < 0 {
+			p -= math.Floor(p)
+		}
+	}
+	o.pos = p
+}
+
+// Reset returns the oscillator to the start of its cycle.
+func (o *Wavetable) Reset() {
+	o.pos = 0
+}
+
+// lookup returns the value of the cycle in table at the phase p, from 0 to
+// 1, interpolating linearly and wrapping around at the end of the table.
+func lookup(table []Sample, p float64) Sample {
+	x := p * float64(len(table))
+	j := int(x)
+	f := Sample(x - float64(j))
+	j %= len(table)
+	v := table[j]
+	if f > 0 {
+		v += (table[(j+1)%len(table)] - v) * f
+	}
+	return v
+}
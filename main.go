@@ -18,10 +18,12 @@ package main
 
 import (
 	"flag"
+	"fmt"
 	"log"
 	"net/http"
 	"os"
 
+	"github.com/nf/sigourney/audio"
 	"github.com/nf/sigourney/ui"
 
 	"code.google.com/p/portaudio-go/portaudio"
@@ -32,6 +34,7 @@ import (
 var (
 	listenAddr = flag.String("listen", "localhost:8080", "listen address")
 	doDemo     = flag.Bool("demo", false, "play demo sound")
+	doList     = flag.Bool("list_devices", false, "list audio output devices")
 )
 
 func main() {
@@ -43,6 +46,13 @@ func main() {
 	portmidi.Initialize()
 	defer portmidi.Terminate()
 
+	if *doList {
+		if err := listDevices(); err != nil {
+			log.Println(err)
+		}
+		return
+	}
+
 	if *doDemo {
 		if err := demo(); err != nil {
 			log.Println(err)
@@ -62,6 +72,17 @@ func main() {
 	os.Stdin.Read([]byte{0})
 }
 
+func listDevices() error {
+	ds, err := audio.Devices()
+	if err != nil {
+		return err
+	}
+	for _, d := range ds {
+		fmt.Printf("%s (%d channels, %vHz)\n", d.Name, d.Channels, d.SampleRate)
+	}
+	return nil
+}
+
 func socketHandler(w http.ResponseWriter, r *http.Request) {
 	c, err := websocket.Upgrade(w, r, nil, 1024, 1024)
 	if err != nil {
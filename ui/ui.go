@@ -21,6 +21,7 @@ import (
 	"errors"
 	"fmt"
 	"io/ioutil"
+	"log"
 	"os"
 	"path/filepath"
 	"regexp"
@@ -136,11 +137,11 @@ func (u *UI) destroy(name string) error {
 	if !ok {
 		return errors.New("bad Name: " + name)
 	}
-	if o.dup != nil {
-		u.engine.Lock()
-		u.engine.RemoveTicker(o.dup)
-		u.engine.Unlock()
+	u.engine.Lock()
+	for _, t := range o.tickers() {
+		u.engine.RemoveTicker(t)
 	}
+	u.engine.Unlock()
 	for d := range o.output {
 		u.disconnect(name, d.name, d.input)
 	}
@@ -220,7 +221,7 @@ func (u *UI) disconnect(from, to, input string) error {
 
 	u.engine.Lock()
 	f.output[dest{to, input}].Close()
-	t.proc.(audio.Sink).Input(input, audio.Value(0))
+	t.proc.(audio.Sink).Input(input, nil)
 	u.engine.Unlock()
 
 	delete(f.output, dest{to, input})
@@ -244,6 +245,10 @@ func (u *UI) connect(from, to, input string) error {
 	t.proc.(audio.Sink).Input(input, o)
 	u.engine.Unlock()
 
+	if err := audio.CheckTrigger(t.proc.(audio.Sink), input, o); err != nil {
+		log.Printf("connect %s to %s: %v", from, to, err)
+	}
+
 	f.output[dest{to, input}] = o
 	t.Input[input] = from
 
@@ -268,39 +273,130 @@ type dest struct {
 
 func (u *UI) newObject(name, kind string, value float64) {
 	o := NewObject(name, kind, value)
-	if o.dup != nil {
-		u.engine.Lock()
-		u.engine.AddTicker(o.dup)
-		u.engine.Unlock()
+	u.engine.Lock()
+	for _, t := range o.tickers() {
+		u.engine.AddTicker(t)
 	}
+	u.engine.Unlock()
 	u.objects[name] = o
 }
 
+// tickers returns the Tickers the Engine must tick for o to render: its
+// Dup and, for a multi-output module such as a Burst, the module itself.
+func (o *Object) tickers() []audio.Ticker {
+	var ts []audio.Ticker
+	if o.dup != nil {
+		ts = append(ts, o.dup)
+	}
+	if t, ok := o.proc.(audio.Ticker); ok {
+		ts = append(ts, t)
+	}
+	return ts
+}
+
 func NewObject(name, kind string, value float64) *Object {
 	var p interface{}
 	switch kind {
+	case "abs":
+		p = audio.NewAbs()
+	case "additive":
+		p = audio.NewAdditive()
+	case "atten":
+		p = audio.NewAtten()
+	case "burst":
+		p = audio.NewBurst()
+	case "cab":
+		p = audio.NewCabIR(audio.CabClosed)
 	case "clip":
 		p = audio.NewClip()
+	case "clock":
+		p = audio.NewClock()
+	case "clockmul":
+		p = audio.NewClockMul()
+	case "counter":
+		p = audio.NewCounter()
+	case "debounce":
+		p = audio.NewDebounce()
+	case "decimate":
+		p = audio.NewDecimate()
 	case "engine":
 		p = audio.NewEngine()
 	case "env":
 		p = audio.NewEnv()
+	case "expander":
+		p = audio.NewExpander()
+	case "finetune":
+		p = audio.NewFineTune()
+	case "gain":
+		p = audio.NewGain()
+	case "highshelf":
+		p = audio.NewHighShelf()
+	case "impulse":
+		p = audio.NewImpulse()
+	case "invert":
+		p = audio.NewInvert()
+	case "keytrack":
+		p = audio.NewKeyTrack()
+	case "latch":
+		p = audio.NewLatch()
+	case "lfo":
+		p = audio.NewLFO()
+	case "lowpass":
+		p = audio.NewLowPass()
+	case "lowshelf":
+		p = audio.NewLowShelf()
 	case "mul":
 		p = audio.NewMul()
+	case "quantizetrig":
+		p = audio.NewQuantizeTrig()
 	case "rand":
 		p = audio.NewRand()
+	case "reverb":
+		p = audio.NewReverb()
+	case "saw":
+		p = audio.NewSaw()
+	case "shnoise":
+		p = audio.NewSHNoise()
 	case "sin":
 		p = audio.NewSin()
+	case "slew":
+		p = audio.NewSlew()
+	case "softclip":
+		p = audio.NewSoftClip()
 	case "square":
 		p = audio.NewSquare()
+	case "step":
+		p = audio.NewUnitStep()
 	case "sum":
 		p = audio.NewSum()
+	case "taptempo":
+		p = audio.NewTapTempo()
+	case "transient":
+		p = audio.NewTransient()
+	case "tremolo":
+		p = audio.NewTremolo()
 	case "value":
 		p = audio.Value(value)
+	case "velocity":
+		p = audio.NewVelocity()
+	case "vibrato":
+		p = audio.NewVibrato()
+	case "walk":
+		p = audio.NewWalk()
+	case "z1":
+		p = audio.NewZ1()
 	case "note":
 		p = audio.NewMidiNote()
 	case "gate":
 		p = audio.NewMidiGate()
+	case "vel":
+		p = audio.NewMidiVelocity()
+	case "bend":
+		p = audio.NewPitchBend()
+	case "modwheel":
+		p = audio.NewModWheel()
+	case "aftertouch":
+		p = audio.NewAftertouch()
 	default:
 		panic("bad kind: " + kind)
 	}
@@ -334,15 +430,54 @@ func kindInputs() map[string][]string {
 }
 
 var kinds = []string{
+	"abs",
+	"additive",
+	"aftertouch",
+	"atten",
+	"bend",
+	"burst",
+	"cab",
 	"clip",
+	"clock",
+	"clockmul",
+	"counter",
+	"debounce",
+	"decimate",
 	"engine",
 	"env",
+	"expander",
+	"finetune",
+	"gain",
 	"gate",
+	"highshelf",
+	"impulse",
+	"invert",
+	"keytrack",
+	"latch",
+	"lfo",
+	"lowpass",
+	"lowshelf",
+	"modwheel",
 	"mul",
+	"quantizetrig",
 	"rand",
+	"reverb",
+	"saw",
+	"shnoise",
 	"sin",
 	"note",
+	"slew",
+	"softclip",
 	"square",
+	"step",
 	"sum",
+	"taptempo",
+	"transient",
+	"tremolo",
 	"value",
+	"vel",
+	"velocity",
+	"vibrato",
+	"walk",
+	"z1",
 }